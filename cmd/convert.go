@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/in-toto/attestation-verifier/verifier"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert an in-toto v0.9 layout into a layout for this verifier",
+	RunE:  convert,
+}
+
+var (
+	classicLayoutPath     string
+	classicLayoutKeyPaths []string
+	outputPath            string
+)
+
+func init() {
+	convertCmd.Flags().StringVarP(
+		&classicLayoutPath,
+		"layout",
+		"l",
+		"",
+		"in-toto v0.9 layout to convert",
+	)
+
+	convertCmd.Flags().StringArrayVarP(
+		&classicLayoutKeyPaths,
+		"layout-keys",
+		"k",
+		[]string{},
+		"Paths to PEM formatted public keys to verify the layout's signatures with",
+	)
+
+	convertCmd.Flags().StringVarP(
+		&outputPath,
+		"output",
+		"o",
+		"",
+		"Path to write the converted layout to, defaults to stdout",
+	)
+
+	convertCmd.MarkFlagRequired("layout")
+
+	rootCmd.AddCommand(convertCmd)
+}
+
+func convert(cmd *cobra.Command, args []string) error {
+	keys := make([]in_toto.Key, 0, len(classicLayoutKeyPaths))
+	for _, keyPath := range classicLayoutKeyPaths {
+		key := in_toto.Key{}
+		if err := key.LoadKeyDefaults(keyPath); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	classicLayout, err := verifier.LoadClassicLayout(classicLayoutPath, keys...)
+	if err != nil {
+		return err
+	}
+
+	layout, err := verifier.ConvertClassicLayout(classicLayout)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if len(outputPath) > 0 {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(layout); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -1,14 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/in-toto/attestation-verifier/verifier"
+	"github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 var rootCmd = &cobra.Command{
@@ -20,6 +29,22 @@ var (
 	layoutPath      string
 	attestationsDir string
 	parametersPath  string
+	revocationsPath string
+	vsaPath         string
+	vsaKeyPath      string
+	vsaVerifierID   string
+	vsaResourceURI  string
+	vsaPolicyURI    string
+	vsaLevels       []string
+	exceptionsPath  string
+	vexPaths        []string
+	verifyTimeout   time.Duration
+	concurrency     int
+	lazy            bool
+	cacheDir        string
+	cacheKeyPath    string
+	cacheBucket     time.Duration
+	explain         bool
 )
 
 func Execute() {
@@ -53,8 +78,123 @@ func init() {
 		"Path to JSON file containing key-value string pairs for parameter substitution in the layout",
 	)
 
+	rootCmd.Flags().StringVar(
+		&revocationsPath,
+		"revocations",
+		"",
+		"Path to revocation list of keys and attestations, optionally wrapped in a DSSE envelope",
+	)
+
+	rootCmd.Flags().StringVar(
+		&vsaPath,
+		"vsa-output",
+		"",
+		"Path to write a verification summary attestation to on success",
+	)
+
+	rootCmd.Flags().StringVar(
+		&vsaKeyPath,
+		"vsa-key",
+		"",
+		"Path to private key to sign the verification summary with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&vsaVerifierID,
+		"vsa-verifier-id",
+		"https://github.com/in-toto/attestation-verifier",
+		"Verifier ID to record in the verification summary",
+	)
+
+	rootCmd.Flags().StringVar(
+		&vsaResourceURI,
+		"vsa-resource-uri",
+		"",
+		"URI of the verified resource, defaults to the name of the first product",
+	)
+
+	rootCmd.Flags().StringVar(
+		&vsaPolicyURI,
+		"vsa-policy-uri",
+		"",
+		"URI the layout is published at, recorded with its digest as the verification summary's policy",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&vsaLevels,
+		"vsa-level",
+		nil,
+		"Level to record as verified in the verification summary, may be repeated",
+	)
+
+	rootCmd.Flags().StringVar(
+		&exceptionsPath,
+		"vuln-exceptions",
+		"",
+		"Path to YAML file of accepted vulnerability findings",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&vexPaths,
+		"vex",
+		nil,
+		"Path to OpenVEX document suppressing vulnerability findings, may be repeated",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&verifyTimeout,
+		"timeout",
+		0,
+		"Maximum time to spend verifying, unlimited if zero",
+	)
+
+	rootCmd.Flags().IntVar(
+		&concurrency,
+		"concurrency",
+		0,
+		"Number of signatures and claims to verify at once, defaults to the number of CPUs",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&lazy,
+		"lazy",
+		false,
+		"Only verify attestations for steps used by the layout",
+	)
+
+	rootCmd.Flags().StringVar(
+		&cacheDir,
+		"cache-dir",
+		"",
+		"Directory to cache verification results and signature checks in",
+	)
+
+	rootCmd.Flags().StringVar(
+		&cacheKeyPath,
+		"cache-key-file",
+		"",
+		"Path to a secret key authenticating cache entries, required with --cache-dir",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&cacheBucket,
+		"cache-time-bucket",
+		time.Hour,
+		"Period a cached verification result is reused for, results are not cached if zero",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&explain,
+		"explain",
+		false,
+		"Show the value of each sub-expression of failed attribute rules",
+	)
+
 	rootCmd.MarkFlagRequired("layout")
 	rootCmd.MarkFlagRequired("attestations-directory")
+	// Without a key that outlives the run, cache entries could never be
+	// reused by later runs
+	rootCmd.MarkFlagsRequiredTogether("cache-dir", "cache-key-file")
 }
 
 func verify(cmd *cobra.Command, args []string) error {
@@ -69,8 +209,27 @@ func verify(cmd *cobra.Command, args []string) error {
 	}
 
 	attestations := map[string]*dsse.Envelope{}
+	links := map[string]in_toto.Metadata{}
 	for _, e := range dirEntries {
 		name := e.Name()
+		if strings.HasSuffix(name, ".link") {
+			link, err := verifier.LoadLink(filepath.Join(attestationsDir, name))
+			if err != nil {
+				return err
+			}
+
+			links[strings.TrimSuffix(name, ".link")] = link
+			continue
+		}
+
+		// In lazy mode, attestations the layout does not use are passed
+		// without being read, so that they are only listed as unused
+		attestationName := strings.TrimSuffix(name, ".json")
+		if lazy && !verifier.UsesAttestation(layout, attestationName) {
+			attestations[attestationName] = nil
+			continue
+		}
+
 		ab, err := os.ReadFile(filepath.Join(attestationsDir, name))
 		if err != nil {
 			return err
@@ -92,7 +251,7 @@ func verify(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		attestations[strings.TrimSuffix(name, ".json")] = envelope
+		attestations[attestationName] = envelope
 	}
 
 	parameters := map[string]string{}
@@ -107,5 +266,131 @@ func verify(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	return verifier.Verify(layout, attestations, parameters)
+	opts := []verifier.Option{}
+	if len(links) > 0 {
+		opts = append(opts, verifier.WithLinks(links))
+	}
+
+	if len(revocationsPath) > 0 {
+		revocations, err := verifier.LoadRevocationList(revocationsPath)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, verifier.WithRevocationList(revocations))
+	}
+
+	if len(exceptionsPath) > 0 {
+		exceptions, err := verifier.LoadVulnerabilityExceptions(exceptionsPath)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, verifier.WithVulnerabilityExceptions(exceptions))
+	}
+
+	for _, vexPath := range vexPaths {
+		document, err := verifier.LoadVEXDocument(vexPath)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, verifier.WithVEXDocuments(document))
+	}
+
+	if lazy {
+		opts = append(opts, verifier.WithLazyVerification())
+	}
+
+	if explain {
+		opts = append(opts, verifier.WithExplain())
+	}
+
+	if len(cacheDir) > 0 {
+		cache := &verifier.DiskCache{
+			Dir:        cacheDir,
+			TimeBucket: cacheBucket,
+		}
+
+		key, err := os.ReadFile(cacheKeyPath)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(key)) == 0 {
+			return fmt.Errorf("cache key %s is empty", cacheKeyPath)
+		}
+		cache.Key = key
+
+		opts = append(opts, verifier.WithDiskCache(cache))
+	}
+
+	if concurrency > 0 {
+		opts = append(opts, verifier.WithConcurrency(concurrency))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if verifyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, verifyTimeout)
+		defer cancel()
+	}
+
+	if len(vsaPath) == 0 {
+		return verifier.VerifyContext(ctx, layout, attestations, parameters, opts...)
+	}
+
+	result, err := verifier.VerifyWithResultContext(ctx, layout, attestations, parameters, opts...)
+	if err != nil {
+		return err
+	}
+
+	return writeVSA(result)
+}
+
+func writeVSA(result *verifier.Result) error {
+	layoutBytes, err := os.ReadFile(layoutPath)
+	if err != nil {
+		return err
+	}
+	layoutDigest := sha256.Sum256(layoutBytes)
+
+	statement, err := verifier.GenerateVSA(result, verifier.VSAOptions{
+		Verifier:    verifier.VSAVerifier{ID: vsaVerifierID},
+		ResourceURI: vsaResourceURI,
+		Policy: verifier.VSAResourceDescriptor{
+			URI:    vsaPolicyURI,
+			Digest: map[string]string{"sha256": hex.EncodeToString(layoutDigest[:])},
+		},
+		VerifiedLevels: vsaLevels,
+	})
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	if len(vsaKeyPath) > 0 {
+		signer, err := verifier.LoadSigner(vsaKeyPath)
+		if err != nil {
+			return err
+		}
+
+		envelope, err := verifier.SignVSA(statement, signer)
+		if err != nil {
+			return err
+		}
+
+		output, err = json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+	} else {
+		output, err = protojson.Marshal(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(vsaPath, output, 0644)
 }
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/in-toto/attestation-verifier/server"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve verification requests over HTTP",
+	RunE:  serve,
+}
+
+var (
+	listenAddress   string
+	layoutsDir      string
+	reloadInterval  time.Duration
+	maxRequestBytes int64
+	requestTimeout  time.Duration
+	tlsCertFile     string
+	tlsKeyFile      string
+
+	attestationStoreDir string
+	namespaceLayouts    map[string]string
+	defaultLayout       string
+)
+
+func init() {
+	serveCmd.Flags().StringVar(
+		&listenAddress,
+		"listen",
+		":8080",
+		"Address to listen on",
+	)
+
+	serveCmd.Flags().StringVar(
+		&layoutsDir,
+		"layouts-dir",
+		"",
+		"Directory to load layouts and layout keys from",
+	)
+
+	serveCmd.Flags().DurationVar(
+		&reloadInterval,
+		"reload-interval",
+		30*time.Second,
+		"Interval to check the layouts directory for changes at",
+	)
+
+	serveCmd.Flags().Int64Var(
+		&maxRequestBytes,
+		"max-request-bytes",
+		10<<20,
+		"Maximum size of request bodies",
+	)
+
+	serveCmd.Flags().DurationVar(
+		&requestTimeout,
+		"timeout",
+		30*time.Second,
+		"Maximum time to read and verify a request",
+	)
+
+	serveCmd.Flags().StringVar(
+		&tlsCertFile,
+		"tls-cert",
+		"",
+		"Path to the TLS certificate to serve HTTPS with, required for the admission webhook",
+	)
+
+	serveCmd.Flags().StringVar(
+		&tlsKeyFile,
+		"tls-key",
+		"",
+		"Path to the private key of the TLS certificate",
+	)
+
+	serveCmd.Flags().StringVar(
+		&attestationStoreDir,
+		"attestation-store",
+		"",
+		"Directory of attestations by image digest, enables the admission webhook",
+	)
+
+	serveCmd.Flags().StringToStringVar(
+		&namespaceLayouts,
+		"namespace-layout",
+		nil,
+		"Layout to verify images in a namespace against, as <namespace>=<layout>",
+	)
+
+	serveCmd.Flags().StringVar(
+		&defaultLayout,
+		"default-layout",
+		"",
+		"Layout to verify images in other namespaces against, if unset they are admitted",
+	)
+
+	serveCmd.MarkFlagRequired("layouts-dir")
+	serveCmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	config := server.Config{
+		LayoutsDir:      layoutsDir,
+		MaxRequestBytes: maxRequestBytes,
+	}
+
+	if len(attestationStoreDir) > 0 {
+		// The API server only calls webhooks over HTTPS
+		if len(tlsCertFile) == 0 {
+			return errors.New("the admission webhook requires --tls-cert and --tls-key")
+		}
+
+		config.Admission = &server.AdmissionConfig{
+			Store:            server.DirectoryStore{Dir: attestationStoreDir},
+			NamespaceLayouts: namespaceLayouts,
+			DefaultLayout:    defaultLayout,
+		}
+	}
+
+	s, err := server.New(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go s.Watch(reloadInterval, ctx.Done())
+
+	httpServer := &http.Server{
+		Addr:              listenAddress,
+		Handler:           http.TimeoutHandler(s.Handler(), requestTimeout, "verification timed out"),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       requestTimeout,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if len(tlsCertFile) > 0 {
+		log.Infof("Listening on %s with TLS...", listenAddress)
+		err = httpServer.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	} else {
+		log.Infof("Listening on %s...", listenAddress)
+		err = httpServer.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
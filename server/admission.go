@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	log "github.com/sirupsen/logrus"
+)
+
+// AdmissionConfig configures the admission webhook.
+type AdmissionConfig struct {
+	// Store provides the attestations for image digests.
+	Store AttestationStore
+
+	// NamespaceLayouts maps namespaces to the layout their images are
+	// verified against. Images in other namespaces are verified against
+	// DefaultLayout, or admitted if it is empty.
+	NamespaceLayouts map[string]string
+	DefaultLayout    string
+}
+
+// AttestationStore looks up the attestations for an image digest of the form
+// <algorithm>:<hex>. Attestations are named <step>.<id>.
+type AttestationStore interface {
+	Attestations(ctx context.Context, digest string) (map[string]*dsse.Envelope, error)
+}
+
+// DirectoryStore is an AttestationStore holding the attestations for each
+// digest as <step>.<id>.json files in <Dir>/<algorithm>/<hex>/.
+type DirectoryStore struct {
+	Dir string
+}
+
+func (d DirectoryStore) Attestations(ctx context.Context, digest string) (map[string]*dsse.Envelope, error) {
+	algorithm, hex, err := parseImageDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	digestDir := filepath.Join(d.Dir, algorithm, hex)
+	dirEntries, err := os.ReadDir(digestDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no attestations for %s", digest)
+		}
+		return nil, err
+	}
+
+	attestations := map[string]*dsse.Envelope{}
+	for _, e := range dirEntries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		ab, err := os.ReadFile(filepath.Join(digestDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		envelope := &dsse.Envelope{}
+		if err := json.Unmarshal(ab, envelope); err != nil {
+			return nil, fmt.Errorf("unable to load %s: %w", e.Name(), err)
+		}
+
+		attestations[strings.TrimSuffix(e.Name(), ".json")] = envelope
+	}
+
+	return attestations, nil
+}
+
+// imageDigestLengths holds the length of the hex encoded image digests of
+// each supported algorithm.
+var imageDigestLengths = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// parseImageDigest splits an image digest of the form <algorithm>:<hex>,
+// ensuring the algorithm is supported and the hex digest has its length.
+func parseImageDigest(digest string) (string, string, error) {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	length, supported := imageDigestLengths[algorithm]
+	if !ok || !supported || len(hex) != length || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", "", fmt.Errorf("invalid digest %s", digest)
+	}
+
+	return algorithm, hex, nil
+}
+
+// AdmissionReview is the subset of the Kubernetes admission.k8s.io/v1
+// AdmissionReview used by the webhook.
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionRequest struct {
+	UID       string           `json:"uid"`
+	Kind      GroupVersionKind `json:"kind"`
+	Namespace string           `json:"namespace,omitempty"`
+	Operation string           `json:"operation,omitempty"`
+	Object    json.RawMessage  `json:"object,omitempty"`
+}
+
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+type AdmissionResponse struct {
+	UID      string           `json:"uid"`
+	Allowed  bool             `json:"allowed"`
+	Status   *AdmissionStatus `json:"status,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+type AdmissionStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// podSpec holds the containers of a pod spec.
+type podSpec struct {
+	InitContainers      []container `json:"initContainers"`
+	Containers          []container `json:"containers"`
+	EphemeralContainers []container `json:"ephemeralContainers"`
+}
+
+type container struct {
+	Image string `json:"image"`
+}
+
+// workload holds the pod spec of pods and the pod templates of workload
+// resources.
+type workload struct {
+	Spec struct {
+		podSpec
+		Template struct {
+			Spec podSpec `json:"spec"`
+		} `json:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template struct {
+					Spec podSpec `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+}
+
+func (w workload) images() []string {
+	images := []string{}
+	seen := map[string]bool{}
+	for _, spec := range []podSpec{w.Spec.podSpec, w.Spec.Template.Spec, w.Spec.JobTemplate.Spec.Template.Spec} {
+		for _, containers := range [][]container{spec.InitContainers, spec.Containers, spec.EphemeralContainers} {
+			for _, c := range containers {
+				if c.Image != "" && !seen[c.Image] {
+					seen[c.Image] = true
+					images = append(images, c.Image)
+				}
+			}
+		}
+	}
+
+	return images
+}
+
+// Review decides whether the request in review is admitted. Each image must
+// be pinned by digest and its attestations must verify against the
+// namespace's layout.
+func (s *Server) Review(ctx context.Context, review *AdmissionReview) *AdmissionReview {
+	response := &AdmissionReview{
+		APIVersion: review.APIVersion,
+		Kind:       review.Kind,
+		Response:   &AdmissionResponse{UID: review.Request.UID},
+	}
+
+	reasons := s.review(ctx, review.Request)
+	if len(reasons) == 0 {
+		response.Response.Allowed = true
+		return response
+	}
+
+	response.Response.Status = &AdmissionStatus{
+		Code:    http.StatusForbidden,
+		Message: strings.Join(reasons, "; "),
+	}
+
+	return response
+}
+
+func (s *Server) review(ctx context.Context, request *AdmissionRequest) []string {
+	config := s.config.Admission
+
+	layoutName, ok := config.NamespaceLayouts[request.Namespace]
+	if !ok {
+		layoutName = config.DefaultLayout
+	}
+	if layoutName == "" {
+		return nil
+	}
+
+	// Requests without an object, such as deletions, run no images
+	if len(request.Object) == 0 || string(request.Object) == "null" {
+		return nil
+	}
+
+	w := workload{}
+	if err := json.Unmarshal(request.Object, &w); err != nil {
+		return []string{fmt.Sprintf("unable to read %s: %s", request.Kind.Kind, err)}
+	}
+
+	reasons := []string{}
+	for _, image := range w.images() {
+		if err := s.verifyImage(ctx, layoutName, image); err != nil {
+			reasons = append(reasons, fmt.Sprintf("image %s: %s", image, err))
+		}
+	}
+	sort.Strings(reasons)
+
+	return reasons
+}
+
+// verifyImage verifies the attestations for the image's digest. The image
+// reference and digest are available to the layout as the parameters image
+// and imageDigest. The image is only admitted if the layout's final products
+// include an artifact with its digest.
+func (s *Server) verifyImage(ctx context.Context, layoutName, image string) error {
+	_, digest, ok := strings.Cut(image, "@")
+	if !ok {
+		return fmt.Errorf("image is not pinned by digest")
+	}
+
+	algorithm, hex, err := parseImageDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	loaded, err := s.getLayout(layoutName)
+	if err != nil {
+		return err
+	}
+
+	attestations, err := s.config.Admission.Store.Attestations(ctx, digest)
+	if err != nil {
+		return err
+	}
+
+	result, err := loaded.verifier.VerifyContext(ctx, attestations, map[string]string{
+		"image":       image,
+		"imageDigest": digest,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, product := range result.Products {
+		if product.Digest[algorithm] == hex {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no product of layout %s has digest %s", layoutName, digest)
+}
+
+func (s *Server) handleAdmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.config.MaxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+	}
+
+	review := &AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, fmt.Sprintf("invalid admission review: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if review.Request == nil {
+		http.Error(w, "invalid admission review: no request", http.StatusBadRequest)
+		return
+	}
+
+	response := s.Review(r.Context(), review)
+	if !response.Response.Allowed {
+		log.Infof("Denied %s %s in namespace %s: %s", review.Request.Operation, review.Request.Kind.Kind, review.Request.Namespace, response.Response.Status.Message)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// productDigest is the digest of the final product of the example layout.
+const productDigest = "sha256:58eaf5a78d580f5dbd49d31a5b733094169b31bfdf49055b74bcac2877d8f58c"
+
+// newAdmissionServer returns a server verifying images in the prod namespace
+// against the example layout, with the example attestations stored for each
+// of digests.
+func newAdmissionServer(t *testing.T, digests ...string) *Server {
+	t.Helper()
+
+	layoutBytes, err := os.ReadFile(filepath.Join("..", "layouts", "layout.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutBytes = []byte(strings.Replace(string(layoutBytes), `expires: "2024-10-10T12:23:22Z"`, `expires: "2124-10-10T12:23:22Z"`, 1))
+
+	layoutsDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(layoutsDir, "release.yml"), layoutBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join("..", "test-data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storeDir := t.TempDir()
+	for _, digest := range digests {
+		digestDir := filepath.Join(storeDir, strings.Replace(digest, ":", string(filepath.Separator), 1))
+		if err := os.MkdirAll(digestDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range entries {
+			contents, err := os.ReadFile(filepath.Join("..", "test-data", e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(digestDir, e.Name()), contents, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	s, err := New(Config{
+		LayoutsDir: layoutsDir,
+		Admission: &AdmissionConfig{
+			Store:            DirectoryStore{Dir: storeDir},
+			NamespaceLayouts: map[string]string{"prod": "release"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func reviewPod(t *testing.T, s *Server, image string) *AdmissionResponse {
+	t.Helper()
+
+	object, err := json.Marshal(map[string]any{
+		"spec": map[string]any{"containers": []map[string]string{{"image": image}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.Review(context.Background(), &AdmissionReview{
+		Request: &AdmissionRequest{
+			UID:       "1",
+			Kind:      GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "prod",
+			Object:    object,
+		},
+	}).Response
+}
+
+func TestReview(t *testing.T) {
+	otherDigest := "sha256:" + strings.Repeat("0", 64)
+	s := newAdmissionServer(t, productDigest, otherDigest)
+
+	tests := []struct {
+		name    string
+		image   string
+		allowed bool
+		reason  string
+	}{
+		{
+			name:    "product digest",
+			image:   "registry.example.com/foo@" + productDigest,
+			allowed: true,
+		},
+		{
+			name:   "digest of no product",
+			image:  "registry.example.com/foo@" + otherDigest,
+			reason: "no product of layout release has digest",
+		},
+		{
+			name:   "not pinned",
+			image:  "registry.example.com/foo:latest",
+			reason: "image is not pinned by digest",
+		},
+		{
+			name:   "short digest",
+			image:  "registry.example.com/foo@sha256:58eaf5",
+			reason: "invalid digest",
+		},
+		{
+			name:   "path in digest",
+			image:  "registry.example.com/foo@sha256:../../sha256/" + strings.Repeat("0", 53),
+			reason: "invalid digest",
+		},
+		{
+			name:   "unsupported algorithm",
+			image:  "registry.example.com/foo@md5:" + strings.Repeat("0", 32),
+			reason: "invalid digest",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := reviewPod(t, s, test.image)
+			if response.Allowed != test.allowed {
+				t.Fatalf("allowed %t, want %t (%+v)", response.Allowed, test.allowed, response.Status)
+			}
+			if !test.allowed && !strings.Contains(response.Status.Message, test.reason) {
+				t.Errorf("reason %q, want it to contain %q", response.Status.Message, test.reason)
+			}
+		})
+	}
+}
+
+func TestParseImageDigest(t *testing.T) {
+	tests := []struct {
+		digest string
+		valid  bool
+	}{
+		{productDigest, true},
+		{"sha512:" + strings.Repeat("a", 128), true},
+		{"sha256:" + strings.Repeat("A", 64), false},
+		{"sha256:" + strings.Repeat("a", 63), false},
+		{"sha1:" + strings.Repeat("a", 40), false},
+		{strings.Repeat("a", 64), false},
+		{"sha256:", false},
+	}
+
+	for _, test := range tests {
+		if _, _, err := parseImageDigest(test.digest); (err == nil) != test.valid {
+			t.Errorf("parseImageDigest(%q) error %v, want valid %t", test.digest, err, test.valid)
+		}
+	}
+}
+
+func TestReviewDelete(t *testing.T) {
+	s := newAdmissionServer(t)
+
+	response := s.Review(context.Background(), &AdmissionReview{
+		Request: &AdmissionRequest{
+			UID:       "1",
+			Kind:      GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "prod",
+			Operation: "DELETE",
+		},
+	}).Response
+	if !response.Allowed {
+		t.Errorf("deletion denied: %+v", response.Status)
+	}
+}
@@ -0,0 +1,411 @@
+// Package server exposes the verifier over HTTP.
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/in-toto/attestation-verifier/verifier"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config configures a Server.
+type Config struct {
+	// LayoutsDir holds layouts named <name>.yml or <name>.yaml, and in-toto
+	// v0.9 layouts named <name>.layout signed by each key in
+	// keys/<name>/.
+	LayoutsDir string
+
+	// MaxRequestBytes limits the size of request bodies.
+	MaxRequestBytes int64
+
+	// Admission enables the admission webhook if set.
+	Admission *AdmissionConfig
+}
+
+// VerifyRequest is the body of a verification request. Attestations are DSSE
+// envelopes named <step>.<id> as in an attestations directory. Bundles hold
+// JSON Lines of DSSE envelopes for the step they are keyed by.
+type VerifyRequest struct {
+	Layout       string                    `json:"layout"`
+	Parameters   map[string]string         `json:"parameters,omitempty"`
+	Attestations map[string]*dsse.Envelope `json:"attestations,omitempty"`
+	Bundles      map[string]string         `json:"bundles,omitempty"`
+}
+
+// VerifyResponse is the body of the response to a verification request.
+type VerifyResponse struct {
+	Verified bool             `json:"verified"`
+	Error    string           `json:"error,omitempty"`
+	Result   *verifier.Result `json:"result,omitempty"`
+}
+
+// Server verifies attestations against the layouts in a directory.
+type Server struct {
+	config Config
+
+	mu          sync.RWMutex
+	layouts     map[string]*loadedLayout
+	fingerprint string
+}
+
+// loadedLayout is a layout with the verifier built for it. The verifier's
+// keys and compiled rules are reused by every verification until the layouts
+// are reloaded.
+type loadedLayout struct {
+	layout   *verifier.Layout
+	verifier *verifier.Verifier
+}
+
+// New returns a server with the layouts in config.LayoutsDir loaded.
+func New(config Config) (*Server, error) {
+	s := &Server{config: config}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload loads the layouts again if the directory changed since they were
+// last loaded, and reports whether it did. The loaded layouts are kept if any
+// fails to load.
+func (s *Server) Reload() (bool, error) {
+	fingerprint, err := getFingerprint(s.config.LayoutsDir)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	unchanged := fingerprint == s.fingerprint
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	layouts, err := loadLayouts(s.config.LayoutsDir)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.layouts = layouts
+	s.fingerprint = fingerprint
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch reloads the layouts every interval until stop is closed.
+func (s *Server) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := s.Reload()
+			if err != nil {
+				log.Errorf("Unable to reload layouts: %s", err)
+			} else if reloaded {
+				log.Info("Reloaded layouts.")
+			}
+		}
+	}
+}
+
+// Handler returns the HTTP API:
+//
+//	POST /v1/verify   verifies a VerifyRequest
+//	GET  /v1/layouts  lists the names of the loaded layouts
+//	POST /v1/admission  reviews an AdmissionReview, if enabled
+//	GET  /healthz     reports the server is up
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/verify", s.handleVerify)
+	if s.config.Admission != nil {
+		mux.HandleFunc("/v1/admission", s.handleAdmission)
+	}
+	mux.HandleFunc("/v1/layouts", s.handleLayouts)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+func (s *Server) handleLayouts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	names := make([]string, 0, len(s.layouts))
+	for name := range s.layouts {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.config.MaxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+	}
+
+	request := &VerifyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	loaded, err := s.getLayout(request.Layout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := checkParameters(loaded.layout, request.Parameters); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	attestations, err := getAttestations(request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := loaded.verifier.VerifyContext(r.Context(), attestations, request.Parameters)
+	if err != nil {
+		if errors.Is(err, verifier.ErrAborted) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, VerifyResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, VerifyResponse{Verified: true, Result: result})
+}
+
+// getLayout returns the named layout and its verifier. The verifier
+// substitutes parameters in its own copy of the layout, so the layout is
+// shared by concurrent verifications and must not be modified.
+func (s *Server) getLayout(name string) (*loadedLayout, error) {
+	s.mu.RLock()
+	loaded, ok := s.layouts[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %s", name)
+	}
+
+	return loaded, nil
+}
+
+// checkParameters ensures clients only set the parameters the layout refers
+// to.
+func checkParameters(layout *verifier.Layout, parameters map[string]string) error {
+	declared := map[string]bool{}
+	for _, name := range verifier.ParameterNames(layout) {
+		declared[name] = true
+	}
+
+	for name := range parameters {
+		if !declared[name] {
+			return fmt.Errorf("layout does not use parameter %s", name)
+		}
+	}
+
+	return nil
+}
+
+// getAttestations combines the request's attestations and bundles. Bundled
+// envelopes are named <step>.bundle-<line>.
+func getAttestations(request *VerifyRequest) (map[string]*dsse.Envelope, error) {
+	attestations := map[string]*dsse.Envelope{}
+	for name, envelope := range request.Attestations {
+		if !strings.Contains(name, ".") {
+			return nil, fmt.Errorf("attestation name %s must be of the form <step>.<id>", name)
+		}
+
+		attestations[name] = envelope
+	}
+
+	for step, bundle := range request.Bundles {
+		scanner := bufio.NewScanner(strings.NewReader(bundle))
+		scanner.Buffer(nil, len(bundle)+1)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+
+			envelope := &dsse.Envelope{}
+			if err := json.Unmarshal(scanner.Bytes(), envelope); err != nil {
+				return nil, fmt.Errorf("bundle for step %s, line %d: %w", step, line, err)
+			}
+
+			attestations[fmt.Sprintf("%s.bundle-%d", step, line)] = envelope
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return attestations, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("Unable to write response: %s", err)
+	}
+}
+
+// loadLayouts reads the layouts in dir as YAML, converting in-toto v0.9
+// layouts, and builds a verifier for each.
+func loadLayouts(dir string) (map[string]*loadedLayout, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := map[string]*loadedLayout{}
+	for _, e := range dirEntries {
+		if e.IsDir() {
+			continue
+		}
+
+		name := e.Name()
+		extension := filepath.Ext(name)
+		layoutName := strings.TrimSuffix(name, extension)
+		if _, ok := layouts[layoutName]; ok {
+			return nil, fmt.Errorf("more than one layout named %s", layoutName)
+		}
+
+		var layout *verifier.Layout
+		switch extension {
+		case ".yml", ".yaml":
+			layoutBytes, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			layout, err = verifier.ParseLayout(layoutBytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load layout %s: %w", name, err)
+			}
+
+		case ".layout":
+			layout, err = loadClassicLayout(dir, layoutName)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load layout %s: %w", name, err)
+			}
+
+		default:
+			continue
+		}
+
+		v, err := verifier.New(layout)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load layout %s: %w", name, err)
+		}
+
+		layouts[layoutName] = &loadedLayout{layout: layout, verifier: v}
+	}
+
+	return layouts, nil
+}
+
+func loadClassicLayout(dir, layoutName string) (*verifier.Layout, error) {
+	keyDir := filepath.Join(dir, "keys", layoutName)
+	keyEntries, err := os.ReadDir(keyDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load layout keys: %w", err)
+	}
+
+	keys := []in_toto.Key{}
+	for _, e := range keyEntries {
+		if e.IsDir() {
+			continue
+		}
+
+		key := in_toto.Key{}
+		if err := key.LoadKeyDefaults(filepath.Join(keyDir, e.Name())); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", keyDir)
+	}
+
+	classicLayout, err := verifier.LoadClassicLayout(filepath.Join(dir, layoutName+".layout"), keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifier.ConvertClassicLayout(classicLayout)
+}
+
+// getFingerprint summarizes the names, sizes and modification times of the
+// files under dir.
+func getFingerprint(dir string) (string, error) {
+	entries := []string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(entries)
+
+	return strings.Join(entries, "\n"), nil
+}
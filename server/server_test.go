@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// newNPMServer returns a server with the npm example layout, and a request
+// for the npm example attestations with the example parameters.
+func newNPMServer(t *testing.T) (*Server, *VerifyRequest) {
+	t.Helper()
+
+	layoutBytes, err := os.ReadFile(filepath.Join("..", "layouts", "layout-npm.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutBytes = []byte(strings.Replace(string(layoutBytes), `expires: "2024-10-10T12:23:22Z"`, `expires: "2124-10-10T12:23:22Z"`, 1))
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "npm.yml"), layoutBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{LayoutsDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &VerifyRequest{Layout: "npm", Attestations: map[string]*dsse.Envelope{}}
+
+	parametersBytes, err := os.ReadFile(filepath.Join("..", "parameters", "npm-sigstore.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(parametersBytes, &request.Parameters); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"build.fe1c6281", "publish.fe1c6281"} {
+		envelopeBytes, err := os.ReadFile(filepath.Join("..", "test-data-npm", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		envelope := &dsse.Envelope{}
+		if err := json.Unmarshal(envelopeBytes, envelope); err != nil {
+			t.Fatal(err)
+		}
+		request.Attestations[name] = envelope
+	}
+
+	return s, request
+}
+
+func postVerify(t *testing.T, s *Server, request *VerifyRequest) (int, *VerifyResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/verify", bytes.NewReader(body)))
+
+	response := &VerifyResponse{}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return recorder.Code, response
+}
+
+func TestVerify(t *testing.T) {
+	s, request := newNPMServer(t)
+
+	status, response := postVerify(t, s, request)
+	if status != http.StatusOK || !response.Verified {
+		t.Fatalf("status %d, error %q", status, response.Error)
+	}
+}
+
+func TestVerifyParameterInjection(t *testing.T) {
+	s, request := newNPMServer(t)
+	request.Parameters["github_repository_id"] = "1' || 'a' == 'a"
+
+	status, response := postVerify(t, s, request)
+	if status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if response.Verified {
+		t.Fatal("verification with an injected parameter passed")
+	}
+}
+
+func TestVerifyUndeclaredParameter(t *testing.T) {
+	s, request := newNPMServer(t)
+	request.Parameters["unused"] = "x"
+
+	if status, _ := postVerify(t, s, request); status != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestReloadRebuildsVerifier(t *testing.T) {
+	s, request := newNPMServer(t)
+
+	loaded, err := s.getLayout("npm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, response := postVerify(t, s, request); status != http.StatusOK || !response.Verified {
+		t.Fatalf("status %d, error %q", status, response.Error)
+	}
+	if again, err := s.getLayout("npm"); err != nil || again.verifier != loaded.verifier {
+		t.Fatalf("verifier rebuilt without a reload (%v)", err)
+	}
+
+	if reloaded, err := s.Reload(); err != nil || reloaded {
+		t.Fatalf("unchanged layouts reloaded %t (%v)", reloaded, err)
+	}
+	if again, _ := s.getLayout("npm"); again.verifier != loaded.verifier {
+		t.Fatal("verifier rebuilt for unchanged layouts")
+	}
+
+	path := filepath.Join(s.config.LayoutsDir, "npm.yml")
+	layoutBytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(layoutBytes, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded, err := s.Reload(); err != nil || !reloaded {
+		t.Fatalf("changed layouts reloaded %t (%v)", reloaded, err)
+	}
+	if again, _ := s.getLayout("npm"); again.verifier == loaded.verifier {
+		t.Fatal("verifier kept after the layouts were reloaded")
+	}
+
+	if status, response := postVerify(t, s, request); status != http.StatusOK || !response.Verified {
+		t.Fatalf("status %d, error %q", status, response.Error)
+	}
+}
@@ -0,0 +1,218 @@
+package verifier
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+)
+
+// Kinds of artifact names, each normalized differently before artifact rules
+// are applied.
+const (
+	fileArtifact = "file"
+	uriArtifact  = "uri"
+	purlArtifact = "purl"
+	ociArtifact  = "oci"
+)
+
+// registryHostPattern matches a hostname with an optional port.
+var registryHostPattern = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?$`)
+
+// isRegistryHost reports whether the first segment of a reference names a
+// registry rather than a directory or repository: a valid hostname that has
+// a dot or a port, or localhost.
+func isRegistryHost(segment string) bool {
+	if !registryHostPattern.MatchString(segment) {
+		return false
+	}
+
+	return strings.ContainsAny(segment, ".:") || strings.EqualFold(segment, "localhost")
+}
+
+// getArtifactKind classifies an artifact name or rule pattern. purls are
+// recognized by their `pkg:` scheme, URIs by `<scheme>://`. OCI references
+// either use an `oci://` scheme, or start with a registry host and end in a
+// tag or digest. Short references such as `alpine:3` must use the `oci://`
+// scheme. Everything else is a file path.
+func getArtifactKind(name string) string {
+	switch {
+	case strings.HasPrefix(strings.ToLower(name), "pkg:"):
+		return purlArtifact
+	case strings.HasPrefix(strings.ToLower(name), "oci://"):
+		return ociArtifact
+	case strings.Contains(name, "://"):
+		return uriArtifact
+	}
+
+	segments := strings.Split(name, "/")
+	if len(segments) < 2 {
+		return fileArtifact
+	}
+
+	if isRegistryHost(segments[0]) && strings.ContainsAny(segments[len(segments)-1], ":@") {
+		return ociArtifact
+	}
+
+	return fileArtifact
+}
+
+// normalizeArtifactName returns the canonical form of an artifact name or
+// rule pattern according to its kind.
+func normalizeArtifactName(name string) string {
+	switch getArtifactKind(name) {
+	case purlArtifact:
+		return normalizePURL(name)
+	case uriArtifact:
+		return normalizeURI(name)
+	case ociArtifact:
+		return normalizeOCIReference(name)
+	default:
+		return path.Clean(name)
+	}
+}
+
+// indexArtifacts keys artifacts by their normalized names, returning the
+// names in the order the artifacts are listed. Artifacts whose names
+// normalize to the same value cannot be told apart by rules and are an error.
+func indexArtifacts(artifacts []*attestationv1.ResourceDescriptor) (map[string]*attestationv1.ResourceDescriptor, []string, error) {
+	indexed := make(map[string]*attestationv1.ResourceDescriptor, len(artifacts))
+	names := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		name := normalizeArtifactName(artifact.Name)
+		if other, ok := indexed[name]; ok {
+			return nil, nil, fmt.Errorf("artifacts %q and %q both normalize to %q", other.Name, artifact.Name, name)
+		}
+		indexed[name] = artifact
+		names = append(names, name)
+	}
+
+	return indexed, names, nil
+}
+
+// normalizePrefix normalizes a MATCH rule source or destination prefix. Only
+// file path prefixes are treated as directories.
+func normalizePrefix(prefix string) string {
+	if prefix == "" || getArtifactKind(prefix) != fileArtifact {
+		return prefix
+	}
+
+	prefix = path.Clean(prefix)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// normalizeURI lowercases the scheme and host and cleans the path, leaving
+// `//` after the scheme and the query and fragment untouched.
+func normalizeURI(uri string) string {
+	separator := strings.Index(uri, "://")
+	scheme, rest := strings.ToLower(uri[:separator]), uri[separator+3:]
+
+	suffix := ""
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest, suffix = rest[:i], rest[i:]
+	}
+
+	authority, uriPath := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, uriPath = rest[:i], rest[i:]
+	}
+
+	// userinfo is case sensitive, the host isn't
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[:i+1] + strings.ToLower(authority[i+1:])
+	} else {
+		authority = strings.ToLower(authority)
+	}
+
+	if uriPath != "" {
+		uriPath = path.Clean(uriPath)
+	}
+
+	return scheme + "://" + authority + uriPath + suffix
+}
+
+// normalizePURL applies the purl specification's canonicalization: the scheme
+// and type are lowercased, qualifier keys are lowercased and sorted, and
+// names are lowercased for types that are case insensitive.
+func normalizePURL(purl string) string {
+	rest := strings.TrimLeft(purl[len("pkg:"):], "/")
+
+	subpath := ""
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest, subpath = rest[:i], rest[i:]
+	}
+
+	qualifiers := ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, qualifiers = rest[:i], rest[i+1:]
+	}
+
+	purlType, name := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		purlType, name = rest[:i], rest[i:]
+	}
+	purlType = strings.ToLower(purlType)
+
+	version := ""
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, version = name[:i], name[i:]
+	}
+
+	switch purlType {
+	case "bitbucket", "github":
+		name = strings.ToLower(name)
+	case "pypi":
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+
+	if qualifiers != "" {
+		pairs := strings.Split(qualifiers, "&")
+		for i, pair := range pairs {
+			if key, value, ok := strings.Cut(pair, "="); ok {
+				pairs[i] = strings.ToLower(key) + "=" + value
+			}
+		}
+		sort.Strings(pairs)
+		qualifiers = "?" + strings.Join(pairs, "&")
+	}
+
+	return "pkg:" + purlType + name + version + qualifiers + subpath
+}
+
+// normalizeOCIReference returns the fully qualified form of an OCI image
+// reference, expanding Docker Hub shorthands as container tooling does.
+func normalizeOCIReference(reference string) string {
+	if strings.HasPrefix(strings.ToLower(reference), "oci://") {
+		reference = reference[len("oci://"):]
+	}
+
+	registry, repository := "docker.io", reference
+	if i := strings.Index(reference, "/"); i >= 0 {
+		candidate := reference[:i]
+		if isRegistryHost(candidate) {
+			registry, repository = strings.ToLower(candidate), reference[i+1:]
+		}
+	}
+
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		registry = "docker.io"
+	}
+
+	name := repository
+	if i := strings.IndexAny(repository, ":@"); i >= 0 {
+		name = repository[:i]
+	}
+
+	if registry == "docker.io" && !strings.Contains(name, "/") {
+		repository = "library/" + repository
+	}
+
+	return registry + "/" + repository
+}
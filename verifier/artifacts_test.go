@@ -0,0 +1,129 @@
+package verifier
+
+import (
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+)
+
+func TestGetArtifactKind(t *testing.T) {
+	digest := "sha256:58eaf5a78d580f5dbd49d31a5b733094169b31bfdf49055b74bcac2877d8f58c"
+
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{"foo", fileArtifact},
+		{"bin/foo", fileArtifact},
+		{"./src/main.go", fileArtifact},
+		{"foo@1.0.0.tgz", fileArtifact},
+		{"user@example.com", fileArtifact},
+		{"Foo:bar", fileArtifact},
+		{"src/*", fileArtifact},
+		{"pkg:npm/foo@1.0.0", purlArtifact},
+		{"PKG:npm/foo", purlArtifact},
+		{"git+https://github.com/org/repo@ref", uriArtifact},
+		{"https://example.com/foo.tar.gz", uriArtifact},
+		{"oci://alpine", ociArtifact},
+		{"ghcr.io/org/image:1.0", ociArtifact},
+		{"ghcr.io/org/image@" + digest, ociArtifact},
+		{"localhost/image:latest", ociArtifact},
+		{"localhost:5000/image:latest", ociArtifact},
+		{"ghcr.io/org/image", fileArtifact},
+		{"oci://ubuntu:22.04", ociArtifact},
+		{"ubuntu:22.04", fileArtifact},
+		{"alpine@" + digest, fileArtifact},
+		{"report:v2", fileArtifact},
+		{"foo:bar", fileArtifact},
+		{"./dist/app@1.0", fileArtifact},
+		{"../x/y@z", fileArtifact},
+		{"./build/foo:bar", fileArtifact},
+		{"build/foo:bar", fileArtifact},
+		{"-bad.host/image:1", fileArtifact},
+		{"docker.io/library/alpine:*", ociArtifact},
+	}
+
+	for _, test := range tests {
+		if kind := getArtifactKind(test.name); kind != test.kind {
+			t.Errorf("getArtifactKind(%q) = %s, want %s", test.name, kind, test.kind)
+		}
+	}
+}
+
+func TestNormalizeArtifactName(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalized string
+	}{
+		{"./bin/foo", "bin/foo"},
+		{"bin//foo/../bar", "bin/bar"},
+		{"pkg:NPM/foo@1.0.0", "pkg:npm/foo@1.0.0"},
+		{"pkg:npm/Foo@1.0.0", "pkg:npm/Foo@1.0.0"},
+		{"pkg:github/Org/Repo@v1", "pkg:github/org/repo@v1"},
+		{"pkg:pypi/Django_Rest@3.0", "pkg:pypi/django-rest@3.0"},
+		{"pkg:deb/debian/curl@7.0?Distro=bookworm&arch=amd64", "pkg:deb/debian/curl@7.0?arch=amd64&distro=bookworm"},
+		{"pkg://npm/foo", "pkg:npm/foo"},
+		{"HTTPS://Example.COM/a/./b/../c?Q=1", "https://example.com/a/c?Q=1"},
+		{"git+https://User@GitHub.com/org/repo", "git+https://User@github.com/org/repo"},
+		{"oci://alpine:3", "docker.io/library/alpine:3"},
+		{"oci://ubuntu:22.04", "docker.io/library/ubuntu:22.04"},
+		{"ubuntu:22.04", "ubuntu:22.04"},
+		{"./dist/app@1.0", "dist/app@1.0"},
+		{"oci://alpine@sha256:58eaf5a78d580f5dbd49d31a5b733094169b31bfdf49055b74bcac2877d8f58c", "docker.io/library/alpine@sha256:58eaf5a78d580f5dbd49d31a5b733094169b31bfdf49055b74bcac2877d8f58c"},
+		{"oci://org/image:1", "docker.io/org/image:1"},
+		{"index.docker.io/library/alpine:3", "docker.io/library/alpine:3"},
+		{"GHCR.io/org/image:1", "ghcr.io/org/image:1"},
+	}
+
+	for _, test := range tests {
+		if normalized := normalizeArtifactName(test.name); normalized != test.normalized {
+			t.Errorf("normalizeArtifactName(%q) = %q, want %q", test.name, normalized, test.normalized)
+		}
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		prefix     string
+		normalized string
+	}{
+		{"", ""},
+		{"src", "src/"},
+		{"./src/", "src/"},
+		{"pkg:npm/", "pkg:npm/"},
+		{"https://example.com/", "https://example.com/"},
+	}
+
+	for _, test := range tests {
+		if normalized := normalizePrefix(test.prefix); normalized != test.normalized {
+			t.Errorf("normalizePrefix(%q) = %q, want %q", test.prefix, normalized, test.normalized)
+		}
+	}
+}
+
+func TestIndexArtifacts(t *testing.T) {
+	artifact := func(name string) *attestationv1.ResourceDescriptor {
+		return &attestationv1.ResourceDescriptor{Name: name, Digest: map[string]string{"sha256": "aa"}}
+	}
+
+	indexed, names, err := indexArtifacts([]*attestationv1.ResourceDescriptor{artifact("./bin/foo"), artifact("pkg:NPM/foo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 2 || indexed["bin/foo"] == nil || indexed["pkg:npm/foo"] == nil {
+		t.Errorf("indexed %v, want bin/foo and pkg:npm/foo", indexed)
+	}
+	if len(names) != 2 || names[0] != "bin/foo" || names[1] != "pkg:npm/foo" {
+		t.Errorf("names %v, want them in the listed order", names)
+	}
+
+	for _, colliding := range [][]string{
+		{"bin/foo", "./bin/foo"},
+		{"bin/foo", "bin/foo"},
+		{"oci://alpine:3", "docker.io/library/alpine:3"},
+	} {
+		if _, _, err := indexArtifacts([]*attestationv1.ResourceDescriptor{artifact(colliding[0]), artifact(colliding[1])}); err == nil {
+			t.Errorf("%q and %q indexed separately", colliding[0], colliding[1])
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package verifier
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Kinds of entries in a DiskCache.
+const (
+	resultCacheEntry    = "results"
+	signatureCacheEntry = "signatures"
+)
+
+// DiskCache stores verification results and the outcomes of signature checks
+// in a directory. Verifying the same attestations again with the same layout,
+// parameters and options returns the stored result. Attestations that were
+// seen before skip their signature check even when other inputs changed.
+//
+// Entries assume the same predicate handlers are used. Failed verifications
+// are not stored. Entries are authenticated with an HMAC key, and entries
+// that were not written with the same key are ignored.
+type DiskCache struct {
+	// Dir is the directory entries are written to. It is created if needed,
+	// readable and writable by the owner only.
+	Dir string
+
+	// Key authenticates entries. Verifiers sharing the key reuse each
+	// other's entries, so it must be kept as safe as the layout's keys.
+	// If Key is empty, a random key is generated and entries are only
+	// reused by verifiers using the same DiskCache.
+	Key []byte
+
+	// TimeBucket is how long a stored result is reused for. Results are
+	// keyed by the period the verification time falls in. Layout expiry is
+	// checked on every verification. Exceptions that depend on the time are
+	// checked again once the period ends. Results are not stored if
+	// TimeBucket is zero.
+	TimeBucket time.Duration
+
+	keyOnce sync.Once
+	key     []byte
+	keyErr  error
+}
+
+// cacheEntry is an entry as written to disk, with the HMAC of its kind, key
+// and value.
+type cacheEntry struct {
+	MAC   string          `json:"mac"`
+	Value json.RawMessage `json:"value"`
+}
+
+// resultCacheValue is a stored Result. Products are stored in their proto
+// JSON form.
+type resultCacheValue struct {
+	VerifiedAt   time.Time                    `json:"verifiedAt"`
+	Attestations map[string]map[string]string `json:"attestations"`
+	Products     []json.RawMessage            `json:"products"`
+	Unused       []string                     `json:"unused,omitempty"`
+	SkippedRules []SkippedRule                `json:"skippedRules,omitempty"`
+}
+
+// signatureCacheValue is the outcome of checking an envelope's signatures
+// against the functionary keys.
+type signatureCacheValue struct {
+	Verified bool     `json:"verified"`
+	KeyIDs   []string `json:"keyIDs,omitempty"`
+}
+
+// macKey returns the key entries are authenticated with.
+func (c *DiskCache) macKey() ([]byte, error) {
+	c.keyOnce.Do(func() {
+		if len(c.Key) > 0 {
+			c.key = c.Key
+			return
+		}
+
+		c.key = make([]byte, 32)
+		_, c.keyErr = rand.Read(c.key)
+	})
+
+	return c.key, c.keyErr
+}
+
+// mac returns the HMAC of the entry of the kind for key with contents.
+func (c *DiskCache) mac(kind, key string, contents []byte) ([]byte, error) {
+	macKey, err := c.macKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &cacheKey{h: hmac.New(sha256.New, macKey)}
+	k.add([]byte(kind))
+	k.add([]byte(key))
+	k.add(contents)
+
+	return k.h.Sum(nil), nil
+}
+
+// load reads the entry of the kind for key into value. It reports whether an
+// entry was found, was written with the cache's key and could be read.
+func (c *DiskCache) load(kind, key string, value any) bool {
+	contents, err := os.ReadFile(filepath.Join(c.Dir, kind, key+".json"))
+	if err != nil {
+		return false
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(contents, entry); err != nil {
+		return false
+	}
+
+	entryMAC, err := hex.DecodeString(entry.MAC)
+	if err != nil {
+		return false
+	}
+	expectedMAC, err := c.mac(kind, key, entry.Value)
+	if err != nil || !hmac.Equal(entryMAC, expectedMAC) {
+		return false
+	}
+
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// store writes the entry of the kind for key. The entry is written to a
+// temporary file first, so concurrent readers never see a partial entry.
+func (c *DiskCache) store(kind, key string, value any) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	entryMAC, err := c.mac(kind, key, valueBytes)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(&cacheEntry{MAC: hex.EncodeToString(entryMAC), Value: valueBytes})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(c.Dir, kind)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, key+".json"))
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+
+	return nil
+}
+
+// cacheKey hashes length-prefixed fields, so that different field values
+// cannot produce the same key.
+type cacheKey struct {
+	h hash.Hash
+}
+
+func newCacheKey(kind string) *cacheKey {
+	k := &cacheKey{h: sha256.New()}
+	k.add([]byte(kind))
+
+	return k
+}
+
+func (k *cacheKey) add(field []byte) {
+	binary.Write(k.h, binary.BigEndian, uint64(len(field)))
+	k.h.Write(field)
+}
+
+func (k *cacheKey) addJSON(value any) error {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	k.add(contents)
+
+	return nil
+}
+
+func (k *cacheKey) String() string {
+	return hex.EncodeToString(k.h.Sum(nil))
+}
+
+// getOptionsDigest returns a digest of the options that affect the outcome of
+// a verification.
+func getOptionsDigest(options *verifyOptions) ([]byte, error) {
+	key := newCacheKey("options")
+	err := key.addJSON(struct {
+		Revocations *RevocationList
+		Exceptions  *VulnerabilityExceptions
+		VEX         []*VEXDocument
+		Limits      Limits
+		Lazy        bool
+	}{options.revocations, options.vulnExceptions, options.vexDocuments, options.limits, options.lazy})
+	if err != nil {
+		return nil, err
+	}
+
+	return key.h.Sum(nil), nil
+}
+
+func (v *Verifier) loadCachedResult(key string) (*Result, bool) {
+	cached := &resultCacheValue{}
+	if !v.options.cache.load(resultCacheEntry, key, cached) {
+		return nil, false
+	}
+
+	result := &Result{
+		VerifiedAt:   cached.VerifiedAt,
+		Attestations: cached.Attestations,
+		Unused:       cached.Unused,
+		SkippedRules: cached.SkippedRules,
+	}
+	for _, productBytes := range cached.Products {
+		product := &attestationv1.ResourceDescriptor{}
+		if err := protojson.Unmarshal(productBytes, product); err != nil {
+			return nil, false
+		}
+		result.Products = append(result.Products, product)
+	}
+
+	return result, true
+}
+
+func (v *Verifier) storeCachedResult(key string, result *Result) error {
+	cached := &resultCacheValue{
+		VerifiedAt:   result.VerifiedAt,
+		Attestations: result.Attestations,
+		Unused:       result.Unused,
+		SkippedRules: result.SkippedRules,
+	}
+	for _, product := range result.Products {
+		productBytes, err := protojson.Marshal(product)
+		if err != nil {
+			return err
+		}
+		cached.Products = append(cached.Products, productBytes)
+	}
+
+	return v.options.cache.store(resultCacheEntry, key, cached)
+}
+
+// resultCacheKey returns the key of the result of verifying the attestations
+// and links with the parameters at now.
+func (v *Verifier) resultCacheKey(attestations map[string]*dsse.Envelope, parameters map[string]string, now time.Time) (string, error) {
+	key := newCacheKey(resultCacheEntry)
+	key.add(v.layoutBytes)
+	key.add(v.optionsDigest)
+	key.add([]byte(now.Truncate(v.options.cache.TimeBucket).UTC().Format(time.RFC3339Nano)))
+
+	// encoding/json sorts map keys, so the same inputs give the same key
+	if err := key.addJSON(parameters); err != nil {
+		return "", err
+	}
+	if err := key.addJSON(attestations); err != nil {
+		return "", err
+	}
+
+	if err := key.addJSON(v.options.links); err != nil {
+		return "", err
+	}
+
+	return key.String(), nil
+}
+
+// signatureCacheKey returns the key of the outcome of checking the envelope's
+// signatures against the layout's functionary keys.
+func (v *Verifier) signatureCacheKey(env *dsse.Envelope) (string, error) {
+	key := newCacheKey(signatureCacheEntry)
+	key.add(v.keysDigest)
+	if err := key.addJSON(env); err != nil {
+		return "", err
+	}
+
+	return key.String(), nil
+}
@@ -0,0 +1,69 @@
+package verifier
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache := &DiskCache{Dir: dir, Key: []byte("secret")}
+
+	stored := &signatureCacheValue{Verified: true, KeyIDs: []string{"alice"}}
+	if err := cache.store(signatureCacheEntry, "aa", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, signatureCacheEntry)} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0o700 {
+			t.Errorf("%s has mode %o, want 700", path, mode)
+		}
+	}
+
+	loaded := &signatureCacheValue{}
+	if !cache.load(signatureCacheEntry, "aa", loaded) || !loaded.Verified || len(loaded.KeyIDs) != 1 {
+		t.Fatalf("loaded %+v, want %+v", loaded, stored)
+	}
+
+	if !(&DiskCache{Dir: dir, Key: []byte("secret")}).load(signatureCacheEntry, "aa", &signatureCacheValue{}) {
+		t.Error("entry not loaded with the same key")
+	}
+	if (&DiskCache{Dir: dir, Key: []byte("other")}).load(signatureCacheEntry, "aa", &signatureCacheValue{}) {
+		t.Error("entry loaded with another key")
+	}
+	if (&DiskCache{Dir: dir}).load(signatureCacheEntry, "aa", &signatureCacheValue{}) {
+		t.Error("entry loaded with a random key")
+	}
+
+	path := filepath.Join(dir, signatureCacheEntry, "aa.json")
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An entry copied to another key does not authenticate
+	if err := os.WriteFile(filepath.Join(dir, signatureCacheEntry, "bb.json"), contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cache.load(signatureCacheEntry, "bb", &signatureCacheValue{}) {
+		t.Error("entry loaded under another key")
+	}
+
+	// Nor does a modified entry
+	tampered := bytes.Replace(contents, []byte(`"alice"`), []byte(`"mallory"`), 1)
+	if bytes.Equal(tampered, contents) {
+		t.Fatalf("entry %s does not record alice", contents)
+	}
+	if err := os.WriteFile(path, tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cache.load(signatureCacheEntry, "aa", &signatureCacheValue{}) {
+		t.Error("modified entry loaded")
+	}
+}
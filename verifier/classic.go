@@ -0,0 +1,257 @@
+package verifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	linkPredicatev0 "github.com/in-toto/attestation/go/predicates/link/v0"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const linkPredicateType = "https://in-toto.io/attestation/link/v0.3"
+
+// LoadClassicLayout loads an in-toto v0.9 layout, either as a Metablock or
+// wrapped in a DSSE envelope. If keys are passed, the layout must carry a
+// valid signature by each of them.
+func LoadClassicLayout(path string, keys ...in_toto.Key) (*in_toto.Layout, error) {
+	metadata, err := in_toto.LoadMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, ok := metadata.GetPayload().(in_toto.Layout)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an in-toto layout", path)
+	}
+
+	for _, key := range keys {
+		if err := metadata.VerifySignature(key); err != nil {
+			return nil, fmt.Errorf("unable to verify layout signature by %s: %w", key.KeyID, err)
+		}
+	}
+
+	return &layout, nil
+}
+
+// ConvertClassicLayout translates an in-toto v0.9 layout into a layout for
+// this verifier. Each step is expected to be attested with link predicates by
+// the step's keys. Layouts with inspections are rejected.
+func ConvertClassicLayout(classic *in_toto.Layout) (*Layout, error) {
+	if len(classic.RootCas) > 0 || len(classic.IntermediateCas) > 0 {
+		return nil, fmt.Errorf("layouts with certificate authorities are not supported")
+	}
+
+	// This verifier doesn't run commands, so dropping inspections would
+	// silently weaken the layout
+	if len(classic.Inspect) > 0 {
+		return nil, fmt.Errorf("inspection %s: inspections are not supported", classic.Inspect[0].Name)
+	}
+
+	layout := &Layout{
+		Expires:       classic.Expires,
+		Functionaries: map[string]Functionary{},
+	}
+
+	for keyID, key := range classic.Keys {
+		layout.Functionaries[keyID] = Functionary{
+			KeyIDHashAlgorithms: key.KeyIDHashAlgorithms,
+			KeyType:             key.KeyType,
+			KeyVal: KeyVal{
+				Public: key.KeyVal.Public,
+			},
+			Scheme: key.Scheme,
+			KeyID:  key.KeyID,
+		}
+	}
+
+	for _, classicStep := range classic.Steps {
+		if len(classicStep.CertificateConstraints) > 0 {
+			return nil, fmt.Errorf("step %s: certificate constraints are not supported", classicStep.Name)
+		}
+
+		expectedMaterials, err := convertClassicRules(classicStep.ExpectedMaterials)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", classicStep.Name, err)
+		}
+
+		expectedProducts, err := convertClassicRules(classicStep.ExpectedProducts)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", classicStep.Name, err)
+		}
+
+		layout.Steps = append(layout.Steps, &Step{
+			Name:              classicStep.Name,
+			CommandArgs:       classicStep.ExpectedCommand,
+			CommandWarn:       true, // in-toto v0.9 only warns on command mismatches
+			ExpectedMaterials: expectedMaterials,
+			ExpectedProducts:  expectedProducts,
+			ExpectedPredicates: []ExpectedStepPredicates{
+				{
+					PredicateType: linkPredicateType,
+					Functionaries: classicStep.PubKeys,
+					Threshold:     classicStep.Threshold,
+				},
+			},
+		})
+	}
+
+	return layout, nil
+}
+
+// convertClassicRules joins tokenized v0.9 artifact rules into the
+// space-separated form used by this verifier's layouts.
+func convertClassicRules(classicRules [][]string) ([]string, error) {
+	rules := make([]string, 0, len(classicRules))
+	for _, classicRule := range classicRules {
+		if _, err := in_toto.UnpackRule(classicRule); err != nil {
+			return nil, err
+		}
+
+		for _, token := range classicRule {
+			if strings.ContainsAny(token, " \t\n") {
+				return nil, fmt.Errorf("rule %s: whitespace in patterns is not supported", classicRule)
+			}
+		}
+
+		rules = append(rules, strings.Join(classicRule, " "))
+	}
+
+	return rules, nil
+}
+
+// LoadLink loads a signed in-toto v0.9 link, either as a Metablock or wrapped
+// in a DSSE envelope.
+func LoadLink(path string) (in_toto.Metadata, error) {
+	metadata, err := in_toto.LoadMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := metadata.GetPayload().(in_toto.Link); !ok {
+		return nil, fmt.Errorf("%s is not an in-toto link", path)
+	}
+
+	return metadata, nil
+}
+
+// verifyLink checks the link's signatures against the layout's keys and
+// returns the keys that signed it, along with its canonical payload.
+func verifyLink(metadata in_toto.Metadata, keys map[string]functionaryKey) ([]string, []byte, error) {
+	acceptedKeys := []string{}
+	for _, signature := range metadata.Sigs() {
+		key, ok := keys[signature.KeyID]
+		if !ok {
+			continue
+		}
+
+		classicKey := in_toto.Key{
+			KeyID:               key.key.KeyID,
+			KeyIDHashAlgorithms: key.key.KeyIDHashAlgorithms,
+			KeyType:             key.key.KeyType,
+			KeyVal: in_toto.KeyVal{
+				Public: key.key.KeyVal.Public,
+			},
+			Scheme: key.key.Scheme,
+		}
+		if err := metadata.VerifySignature(classicKey); err != nil {
+			continue
+		}
+
+		acceptedKeys = append(acceptedKeys, signature.KeyID)
+	}
+
+	if len(acceptedKeys) == 0 {
+		return nil, nil, fmt.Errorf("no valid signatures by known keys")
+	}
+
+	payload, err := cjson.EncodeCanonical(metadata.GetPayload())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return acceptedKeys, payload, nil
+}
+
+// linkToStatement represents a v0.9 link as an in-toto statement with a link
+// predicate. The link's products become the statement's subject.
+func linkToStatement(link in_toto.Link) (*attestationv1.Statement, error) {
+	materials, err := classicArtifactsToDescriptors(link.Materials)
+	if err != nil {
+		return nil, fmt.Errorf("materials: %w", err)
+	}
+
+	products, err := classicArtifactsToDescriptors(link.Products)
+	if err != nil {
+		return nil, fmt.Errorf("products: %w", err)
+	}
+
+	byproducts, err := structpb.NewStruct(link.ByProducts)
+	if err != nil {
+		return nil, err
+	}
+
+	environment, err := structpb.NewStruct(link.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	linkBytes, err := protojson.Marshal(&linkPredicatev0.Link{
+		Name:        link.Name,
+		Command:     link.Command,
+		Materials:   materials,
+		Byproducts:  byproducts,
+		Environment: environment,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(linkBytes, predicate); err != nil {
+		return nil, err
+	}
+
+	return &attestationv1.Statement{
+		Type:          attestationv1.StatementTypeUri,
+		Subject:       products,
+		PredicateType: linkPredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+func classicArtifactsToDescriptors(artifacts map[string]any) ([]*attestationv1.ResourceDescriptor, error) {
+	names := make([]string, 0, len(artifacts))
+	for name := range artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	descriptors := make([]*attestationv1.ResourceDescriptor, 0, len(artifacts))
+	for _, name := range names {
+		hashes, ok := artifacts[name].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid hashes for %s", name)
+		}
+
+		digest := map[string]string{}
+		for algorithm, value := range hashes {
+			value, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s hash for %s", algorithm, name)
+			}
+			digest[algorithm] = value
+		}
+
+		descriptors = append(descriptors, &attestationv1.ResourceDescriptor{
+			Name:   name,
+			Digest: digest,
+		})
+	}
+
+	return descriptors, nil
+}
@@ -0,0 +1,67 @@
+package verifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+)
+
+func TestConvertClassicLayout(t *testing.T) {
+	classic := &in_toto.Layout{
+		Type:    "layout",
+		Expires: "2124-01-01T00:00:00Z",
+		Steps: []in_toto.Step{{
+			Type:            "step",
+			SupplyChainItem: in_toto.SupplyChainItem{Name: "build"},
+			ExpectedCommand: []string{"sh", "-c", "make && make install"},
+			Threshold:       1,
+		}},
+	}
+
+	layout, err := ConvertClassicLayout(classic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := layout.Steps[0]
+	if step.Command != "" || !reflect.DeepEqual(step.CommandArgs, classic.Steps[0].ExpectedCommand) {
+		t.Errorf("command %q and arguments %q, want the arguments %q", step.Command, step.CommandArgs, classic.Steps[0].ExpectedCommand)
+	}
+
+	classic.Inspect = []in_toto.Inspection{{
+		Type:            "inspection",
+		SupplyChainItem: in_toto.SupplyChainItem{Name: "untar"},
+		Run:             []string{"tar", "xf", "foo.tar"},
+	}}
+	if _, err := ConvertClassicLayout(classic); err == nil || !strings.Contains(err.Error(), "inspections are not supported") {
+		t.Errorf("error %v, want inspections rejected", err)
+	}
+}
+
+func TestVerifyNonLink(t *testing.T) {
+	layoutBytes, err := os.ReadFile(filepath.Join("..", "layouts", "layout.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := ParseLayout([]byte(strings.Replace(string(layoutBytes), `expires: "2024-10-10T12:23:22Z"`, `expires: "2124-10-10T12:23:22Z"`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(layout, WithLinks(map[string]in_toto.Metadata{
+		"build.link": &in_toto.Metablock{Signed: in_toto.Layout{Type: "layout"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.VerifyContext(context.Background(), nil, nil); err == nil || !strings.Contains(err.Error(), "not an in-toto link") {
+		t.Errorf("error %v, want the layout passed as a link rejected", err)
+	}
+}
@@ -0,0 +1,152 @@
+package verifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// digestStrengths records the collision resistance in bits of digest
+// algorithms named as in the in-toto digest set specification. Broken
+// algorithms have strength 0, as do git object IDs, which are sha1 unless
+// the repository uses sha256, and directory hashes, which don't name their
+// algorithm. Algorithms missing here are never accepted.
+var digestStrengths = map[string]int{
+	"md5":        0,
+	"sha1":       0,
+	"gitCommit":  0,
+	"gitTree":    0,
+	"gitBlob":    0,
+	"gitTag":     0,
+	"dirHash":    0,
+	"ripemd160":  80,
+	"sha224":     112,
+	"sha512_224": 112,
+	"sha3_224":   112,
+	"sha256":     128,
+	"sha512_256": 128,
+	"sha3_256":   128,
+	"shake128":   128,
+	"blake2s":    128,
+	"sm3":        128,
+	"sha384":     192,
+	"sha3_384":   192,
+	"sha512":     256,
+	"sha3_512":   256,
+	"shake256":   256,
+	"blake2b":    256,
+}
+
+// defaultMinimumStrength is the weakest algorithm whose digests count as
+// evidence unless the digest policy sets another minimum.
+const defaultMinimumStrength = "sha256"
+
+func (p *DigestPolicy) minimumStrength() string {
+	if p == nil || p.MinimumStrength == "" {
+		return defaultMinimumStrength
+	}
+
+	return p.MinimumStrength
+}
+
+// validate ensures the policy only names known algorithms, and that each
+// accepted algorithm meets the minimum strength.
+func (p *DigestPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+
+	minimum, ok := digestStrengths[p.minimumStrength()]
+	if !ok {
+		return fmt.Errorf("unknown digest algorithm %s in digest policy", p.MinimumStrength)
+	}
+
+	for _, algorithm := range p.AcceptedAlgorithms {
+		strength, ok := digestStrengths[algorithm]
+		if !ok {
+			return fmt.Errorf("unknown digest algorithm %s in digest policy", algorithm)
+		}
+
+		if strength < minimum {
+			return fmt.Errorf("digest algorithm %s in digest policy is weaker than the minimum strength %s", algorithm, p.minimumStrength())
+		}
+	}
+
+	return nil
+}
+
+// accepts reports whether digests with algorithm count as evidence under the
+// policy. Without a policy, algorithms as strong as sha256 are accepted.
+func (p *DigestPolicy) accepts(algorithm string) bool {
+	if p != nil && len(p.AcceptedAlgorithms) > 0 {
+		accepted := false
+		for _, acceptedAlgorithm := range p.AcceptedAlgorithms {
+			if acceptedAlgorithm == algorithm {
+				accepted = true
+				break
+			}
+		}
+
+		if !accepted {
+			return false
+		}
+	}
+
+	strength, ok := digestStrengths[algorithm]
+	return ok && strength >= digestStrengths[p.minimumStrength()]
+}
+
+// digestsMatch reports whether two digest sets identify the same artifact:
+// they must share at least one algorithm accepted by the policy, and every
+// algorithm they share must agree, whether accepted or not.
+func digestsMatch(a, b map[string]string, policy *DigestPolicy) bool {
+	accepted := false
+	for algorithm, digestA := range a {
+		digestB, ok := b[algorithm]
+		if !ok {
+			continue
+		}
+
+		if !strings.EqualFold(digestA, digestB) {
+			return false
+		}
+
+		if policy.accepts(algorithm) {
+			accepted = true
+		}
+	}
+
+	return accepted
+}
+
+// unverifiableDigests reports whether two digest sets agree on every
+// algorithm they share without sharing one accepted by the policy, so that
+// whether they identify the same artifact cannot be verified. It returns the
+// shared algorithms, none of which the policy accepts.
+func unverifiableDigests(a, b map[string]string, policy *DigestPolicy) ([]string, bool) {
+	shared := []string{}
+	for algorithm, digestA := range a {
+		digestB, ok := b[algorithm]
+		if !ok {
+			continue
+		}
+
+		if !strings.EqualFold(digestA, digestB) || policy.accepts(algorithm) {
+			return nil, false
+		}
+		shared = append(shared, algorithm)
+	}
+	sort.Strings(shared)
+
+	return shared, true
+}
+
+// describeUnverifiable explains why digests sharing the algorithms cannot be
+// compared.
+func describeUnverifiable(shared []string) string {
+	if len(shared) == 0 {
+		return "share no digest algorithm"
+	}
+
+	return fmt.Sprintf("only share %s, which the digest policy does not accept", strings.Join(shared, ", "))
+}
@@ -0,0 +1,119 @@
+package verifier
+
+import "testing"
+
+func TestDigestsMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   map[string]string
+		policy *DigestPolicy
+		match  bool
+	}{
+		{
+			name:  "same digest",
+			a:     map[string]string{"sha256": "aa"},
+			b:     map[string]string{"sha256": "aa"},
+			match: true,
+		},
+		{
+			name:  "case insensitive",
+			a:     map[string]string{"sha256": "AA"},
+			b:     map[string]string{"sha256": "aa"},
+			match: true,
+		},
+		{
+			name: "different digest",
+			a:    map[string]string{"sha256": "aa"},
+			b:    map[string]string{"sha256": "bb"},
+		},
+		{
+			name:  "subset of algorithms",
+			a:     map[string]string{"sha256": "aa", "sha512": "bb"},
+			b:     map[string]string{"sha256": "aa"},
+			match: true,
+		},
+		{
+			name: "no shared algorithm",
+			a:    map[string]string{"sha256": "aa"},
+			b:    map[string]string{"sha512": "aa"},
+		},
+		{
+			name: "shared algorithms disagree",
+			a:    map[string]string{"sha256": "aa", "sha512": "bb"},
+			b:    map[string]string{"sha256": "aa", "sha512": "cc"},
+		},
+		{
+			name: "weak algorithm by default",
+			a:    map[string]string{"sha1": "aa"},
+			b:    map[string]string{"sha1": "aa"},
+		},
+		{
+			name: "weak algorithm disagreeing",
+			a:    map[string]string{"sha256": "aa", "sha1": "bb"},
+			b:    map[string]string{"sha256": "aa", "sha1": "cc"},
+		},
+		{
+			name: "unknown algorithm",
+			a:    map[string]string{"custom": "aa"},
+			b:    map[string]string{"custom": "aa"},
+		},
+		{
+			name:   "weak algorithm allowed",
+			a:      map[string]string{"sha1": "aa"},
+			b:      map[string]string{"sha1": "aa"},
+			policy: &DigestPolicy{MinimumStrength: "sha1"},
+			match:  true,
+		},
+		{
+			name:   "below minimum strength",
+			a:      map[string]string{"sha256": "aa"},
+			b:      map[string]string{"sha256": "aa"},
+			policy: &DigestPolicy{MinimumStrength: "sha512"},
+		},
+		{
+			name:   "not accepted",
+			a:      map[string]string{"sha256": "aa", "sha512": "bb"},
+			b:      map[string]string{"sha256": "aa"},
+			policy: &DigestPolicy{AcceptedAlgorithms: []string{"sha512"}},
+		},
+		{
+			name:   "accepted",
+			a:      map[string]string{"sha256": "aa", "sha512": "bb"},
+			b:      map[string]string{"sha512": "bb"},
+			policy: &DigestPolicy{AcceptedAlgorithms: []string{"sha512"}},
+			match:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if match := digestsMatch(test.a, test.b, test.policy); match != test.match {
+				t.Errorf("digestsMatch(%v, %v) = %t, want %t", test.a, test.b, match, test.match)
+			}
+		})
+	}
+}
+
+func TestDigestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *DigestPolicy
+		valid  bool
+	}{
+		{"no policy", nil, true},
+		{"default minimum", &DigestPolicy{AcceptedAlgorithms: []string{"sha256", "sha512"}}, true},
+		{"lowered minimum", &DigestPolicy{AcceptedAlgorithms: []string{"sha1"}, MinimumStrength: "sha1"}, true},
+		{"unknown minimum", &DigestPolicy{MinimumStrength: "sha257"}, false},
+		{"unknown accepted algorithm", &DigestPolicy{AcceptedAlgorithms: []string{"SHA-256"}}, false},
+		{"accepted algorithm below default minimum", &DigestPolicy{AcceptedAlgorithms: []string{"sha1"}}, false},
+		{"accepted algorithm below minimum", &DigestPolicy{AcceptedAlgorithms: []string{"sha256"}, MinimumStrength: "sha512"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.policy.validate(); (err == nil) != test.valid {
+				t.Errorf("error %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// maxExplainedValueLength bounds how much of each value an explanation
+// shows, so that selecting a whole predicate does not flood the output.
+const maxExplainedValueLength = 200
+
+// identifierPattern matches keys that can be selected as fields in CEL.
+var identifierPattern = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// explain evaluates the expression against input again, tracking the value of
+// each sub-expression, and returns one line per sub-expression with its value.
+// Failed field lookups are followed by the nearest field that does exist.
+func (c *programCache) explain(ctx context.Context, expression string, input interpreter.Activation) (string, error) {
+	// Macro calls are tracked so that comprehensions are shown as written
+	env, err := c.env.Extend(cel.EnableMacroCallTracking())
+	if err != nil {
+		return "", err
+	}
+
+	checked, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return "", issues.Err()
+	}
+
+	// Both sides of logical operators are evaluated so that every
+	// sub-expression has a value to show
+	programOptions := []cel.ProgramOption{
+		cel.EvalOptions(cel.OptExhaustiveEval),
+		cel.InterruptCheckFrequency(1),
+	}
+	if c.costLimit > 0 {
+		programOptions = append(programOptions, cel.CostLimit(c.costLimit))
+	}
+
+	program, err := env.Program(checked, programOptions...)
+	if err != nil {
+		return "", err
+	}
+
+	_, details, _ := program.ContextEval(ctx, input)
+	if err := checkContext(ctx); err != nil {
+		return "", err
+	}
+	if details == nil || details.State() == nil {
+		return "", fmt.Errorf("no evaluation state recorded for rule '%s'", expression)
+	}
+
+	e := &explanation{
+		state: details.State(),
+		info:  checked.NativeRep().SourceInfo(),
+		seen:  map[string]bool{},
+	}
+	e.visit(checked.NativeRep().Expr())
+
+	return strings.Join(e.lines, "\n"), nil
+}
+
+// explanation collects the lines explaining an evaluated expression.
+type explanation struct {
+	state interpreter.EvalState
+	info  *ast.SourceInfo
+	seen  map[string]bool
+	lines []string
+}
+
+// visit adds lines for the sub-expressions of expr before expr itself, so
+// that the values an operator was given come before its result. Literals and
+// variables are not shown, and neither is the inside of comprehensions,
+// where only the value from the last iteration is recorded.
+func (e *explanation) visit(expr ast.Expr) {
+	if expr.Kind() == ast.LiteralKind || expr.Kind() == ast.IdentKind {
+		return
+	}
+
+	for _, child := range childExprs(expr) {
+		e.visit(child)
+	}
+
+	e.add(expr)
+}
+
+// childExprs returns the operands of expr. Only the iteration range of a
+// comprehension is returned.
+func childExprs(expr ast.Expr) []ast.Expr {
+	children := []ast.Expr{}
+	switch expr.Kind() {
+	case ast.CallKind:
+		call := expr.AsCall()
+		if call.IsMemberFunction() {
+			children = append(children, call.Target())
+		}
+		children = append(children, call.Args()...)
+	case ast.SelectKind:
+		children = append(children, expr.AsSelect().Operand())
+	case ast.ListKind:
+		children = append(children, expr.AsList().Elements()...)
+	case ast.MapKind:
+		for _, entry := range expr.AsMap().Entries() {
+			children = append(children, entry.AsMapEntry().Key(), entry.AsMapEntry().Value())
+		}
+	case ast.StructKind:
+		for _, field := range expr.AsStruct().Fields() {
+			children = append(children, field.AsStructField().Value())
+		}
+	case ast.ComprehensionKind:
+		children = append(children, expr.AsComprehension().IterRange())
+	}
+
+	return children
+}
+
+func (e *explanation) add(expr ast.Expr) {
+	value, ok := e.state.Value(expr.ID())
+	if !ok {
+		return
+	}
+
+	text, err := parser.Unparse(expr, e.info)
+	if err != nil {
+		return
+	}
+
+	line := fmt.Sprintf("  %s = %s", text, formatValue(value))
+	if types.IsError(value) {
+		line = fmt.Sprintf("  %s: %s", text, value)
+		if suggestion := e.nearestPath(expr); suggestion != "" {
+			line += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+	}
+
+	if !e.seen[line] {
+		e.seen[line] = true
+		e.lines = append(e.lines, line)
+	}
+}
+
+// nearestPath returns the path closest to the one expr failed to look up,
+// for field selections and indexes whose operand was found.
+func (e *explanation) nearestPath(expr ast.Expr) string {
+	var operand ast.Expr
+	var missing string
+
+	switch expr.Kind() {
+	case ast.SelectKind:
+		operand = expr.AsSelect().Operand()
+		missing = expr.AsSelect().FieldName()
+	case ast.CallKind:
+		call := expr.AsCall()
+		if call.FunctionName() != "_[_]" || len(call.Args()) != 2 || call.Args()[1].Kind() != ast.LiteralKind {
+			return ""
+		}
+		index, ok := call.Args()[1].AsLiteral().Value().(string)
+		if !ok {
+			return ""
+		}
+		operand = call.Args()[0]
+		missing = index
+	default:
+		return ""
+	}
+
+	value, ok := e.state.Value(operand.ID())
+	if !ok || types.IsError(value) {
+		return ""
+	}
+
+	nearest := ""
+	distance := -1
+	for _, name := range fieldNames(value) {
+		if d := editDistance(strings.ToLower(missing), strings.ToLower(name)); distance == -1 || d < distance {
+			nearest, distance = name, d
+		}
+	}
+	if nearest == "" {
+		return ""
+	}
+
+	text, err := parser.Unparse(operand, e.info)
+	if err != nil {
+		return ""
+	}
+
+	if !identifierPattern.MatchString(nearest) {
+		return fmt.Sprintf("%s[%q]", text, nearest)
+	}
+
+	return fmt.Sprintf("%s.%s", text, nearest)
+}
+
+// fieldNames returns the sorted keys of a map value, or the field names of a
+// message value.
+func fieldNames(value ref.Val) []string {
+	names := []string{}
+	if mapper, ok := value.(traits.Mapper); ok {
+		for it := mapper.Iterator(); it.HasNext() == types.True; {
+			if name, ok := it.Next().Value().(string); ok {
+				names = append(names, name)
+			}
+		}
+	} else if message, ok := value.Value().(proto.Message); ok {
+		fields := message.ProtoReflect().Descriptor().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			names = append(names, string(fields.Get(i).Name()))
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// formatValue returns the JSON form of value where it has one, cut short at
+// maxExplainedValueLength.
+func formatValue(value ref.Val) string {
+	var text string
+	if types.IsUnknown(value) {
+		text = "unknown"
+	} else if native, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{})); err == nil {
+		contents, err := json.Marshal(native.(*structpb.Value).AsInterface())
+		if err != nil {
+			text = fmt.Sprintf("%v", value.Value())
+		} else {
+			text = string(contents)
+		}
+	} else {
+		text = fmt.Sprintf("%v", value.Value())
+	}
+
+	if len(text) > maxExplainedValueLength {
+		text = text[:maxExplainedValueLength] + "..."
+	}
+
+	return text
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,105 @@
+package verifier
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/interpreter"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestExplainAttributeRules(t *testing.T) {
+	env, err := getCELEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate, err := structpb.NewStruct(map[string]any{
+		"builder":   map[string]any{"id": "https://example.com/builder"},
+		"buildType": "make",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := interpreter.NewActivation(map[string]any{
+		"predicateType": "https://slsa.dev/provenance/v1",
+		"predicate":     predicate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rule     Constraint
+		explain  bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name:    "failing rule",
+			rule:    Constraint{Rule: "predicate.builder.id == 'https://example.com/other' && predicate.buildType == 'make'"},
+			explain: true,
+			contains: []string{
+				"verification failed for rule",
+				`  predicate.builder.id = "https://example.com/builder"`,
+				`  predicate.builder.id == "https://example.com/other" = false`,
+				`  predicate.buildType == "make" = true`,
+			},
+		},
+		{
+			name:    "failing rule with a debug message",
+			rule:    Constraint{Rule: "predicate.buildType == 'bazel'", Debug: "unexpected build type"},
+			explain: true,
+			contains: []string{
+				"unexpected build type\nin rule 'predicate.buildType == 'bazel''",
+				`  predicate.buildType = "make"`,
+			},
+		},
+		{
+			name:    "missing field",
+			rule:    Constraint{Rule: "predicate.builder.version == '1'"},
+			explain: true,
+			contains: []string{
+				"no such key: version",
+				"  predicate.builder.version: no such key: version (did you mean predicate.builder.id?)",
+			},
+		},
+		{
+			name:     "missing field without explain mode",
+			rule:     Constraint{Rule: "predicate.builder.version == '1'"},
+			contains: []string{"no such key: version"},
+			excludes: []string{"did you mean"},
+		},
+		{
+			name:     "failing rule without explain mode",
+			rule:     Constraint{Rule: "predicate.buildType == 'bazel'"},
+			contains: []string{"verification failed for rule 'predicate.buildType == 'bazel''"},
+			excludes: []string{"\n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			programs := &programCache{env: env, explainRules: test.explain, programs: map[string]cel.Program{}, tracked: map[string]*trackedProgram{}}
+
+			_, err := applyAttributeRules(context.Background(), programs, input, []Constraint{test.rule}, log.StandardLogger())
+			if err == nil {
+				t.Fatal("rule passed")
+			}
+			for _, s := range test.contains {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("error %q does not contain %q", err, s)
+				}
+			}
+			for _, s := range test.excludes {
+				if strings.Contains(err.Error(), s) {
+					t.Errorf("error %q contains %q", err, s)
+				}
+			}
+		})
+	}
+}
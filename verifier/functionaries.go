@@ -0,0 +1,79 @@
+package verifier
+
+import (
+	"fmt"
+)
+
+// functionaryKey is a single signing key of a (possibly grouped) functionary.
+type functionaryKey struct {
+	// name is the logical functionary the key belongs to, claims are
+	// recorded against it so that all keys in a group count once towards
+	// thresholds.
+	name string
+
+	key Functionary
+}
+
+// getPublicKeys returns the keys of a functionary, which is either the
+// functionary itself or the members of its key group.
+func getPublicKeys(functionary Functionary) []Functionary {
+	if len(functionary.Keys) == 0 {
+		return []Functionary{functionary}
+	}
+
+	return functionary.Keys
+}
+
+// getFunctionaryKeys indexes the keys of all functionaries by key ID.
+func getFunctionaryKeys(functionaries map[string]Functionary) (map[string]functionaryKey, error) {
+	keys := map[string]functionaryKey{}
+
+	for name, functionary := range functionaries {
+		if err := checkNoValidity(functionary); err != nil {
+			return nil, fmt.Errorf("functionary %s: %w", name, err)
+		}
+
+		for _, key := range getPublicKeys(functionary) {
+			if _, ok := keys[key.KeyID]; ok {
+				return nil, fmt.Errorf("key %s is listed for more than one functionary", key.KeyID)
+			}
+
+			if err := checkNoValidity(key); err != nil {
+				return nil, fmt.Errorf("functionary %s, key %s: %w", name, key.KeyID, err)
+			}
+
+			keys[key.KeyID] = functionaryKey{
+				name: name,
+				key:  key,
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// checkNoValidity rejects validity windows. A window can only be honored
+// against the time a signature was made, which the verifier has no trusted
+// source for: statements record times asserted by the signer.
+func checkNoValidity(functionary Functionary) error {
+	if functionary.ValidFrom != "" || functionary.ValidUntil != "" {
+		return fmt.Errorf("validFrom and validUntil are not supported without a trusted signing time, remove the key or revoke it instead")
+	}
+
+	return nil
+}
+
+// resolveFunctionary maps a functionary reference in the layout to the
+// logical functionary name claims are recorded against. References may be
+// functionary names or the key ID of any of a functionary's keys.
+func resolveFunctionary(functionaries map[string]Functionary, keys map[string]functionaryKey, reference string) string {
+	if _, ok := functionaries[reference]; ok {
+		return reference
+	}
+
+	if key, ok := keys[reference]; ok {
+		return key.name
+	}
+
+	return reference
+}
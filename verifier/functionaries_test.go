@@ -0,0 +1,52 @@
+package verifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFunctionaryKeys(t *testing.T) {
+	keys, err := getFunctionaryKeys(map[string]Functionary{
+		"builder": {Keys: []Functionary{{KeyID: "old"}, {KeyID: "new"}}},
+		"tester":  {KeyID: "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for keyID, name := range map[string]string{"old": "builder", "new": "builder", "test": "tester"} {
+		if keys[keyID].name != name {
+			t.Errorf("key %s belongs to %q, want %q", keyID, keys[keyID].name, name)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		functionaries map[string]Functionary
+		err           string
+	}{
+		{
+			name:          "key in two functionaries",
+			functionaries: map[string]Functionary{"builder": {Keys: []Functionary{{KeyID: "key"}}}, "tester": {KeyID: "key"}},
+			err:           "more than one functionary",
+		},
+		{
+			name:          "functionary validity window",
+			functionaries: map[string]Functionary{"builder": {KeyID: "key", ValidUntil: "2024-05-01T00:00:00Z"}},
+			err:           "validFrom and validUntil are not supported",
+		},
+		{
+			name:          "key validity window",
+			functionaries: map[string]Functionary{"builder": {Keys: []Functionary{{KeyID: "key", ValidFrom: "2024-05-01T00:00:00Z"}}}},
+			err:           "validFrom and validUntil are not supported",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := getFunctionaryKeys(test.functionaries); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package verifier
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+)
+
+// artifactPattern is an artifact rule pattern compiled for a pattern mode.
+// Patterns without wildcards are matched by comparison, and all others only
+// against names starting with their literal prefix.
+type artifactPattern struct {
+	pattern string
+	literal bool
+	prefix  string
+
+	// segments holds the pattern's segments in the path mode, and is nil in
+	// the legacy mode
+	segments []string
+}
+
+// compileArtifactPattern checks the syntax of pattern and prepares it for
+// matching in the given pattern mode.
+func compileArtifactPattern(mode, pattern string) (*artifactPattern, error) {
+	p := &artifactPattern{pattern: pattern}
+
+	switch mode {
+	case "", legacyPatternMode:
+		for rest := pattern; len(rest) > 0; {
+			var chunk string
+			_, chunk, rest = scanChunk(rest)
+			if _, _, err := matchChunk(chunk, ""); err != nil {
+				return nil, err
+			}
+		}
+	case pathPatternMode:
+		p.segments = strings.Split(pattern, "/")
+		for _, segment := range p.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, errBadPattern
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid artifact pattern mode %s", mode)
+	}
+
+	wildcard := strings.IndexAny(pattern, `*?[\`)
+	if wildcard == -1 {
+		p.literal = true
+		p.prefix = pattern
+		return p, nil
+	}
+
+	p.prefix = pattern[:wildcard]
+	if p.segments != nil {
+		// In the path mode, "a/**" also matches "a", so the prefix must not
+		// include the separator before a wildcard segment
+		p.prefix = strings.TrimSuffix(p.prefix, "/")
+	}
+
+	return p, nil
+}
+
+// match reports whether name matches the pattern.
+func (p *artifactPattern) match(name string) (bool, error) {
+	switch {
+	case p.literal:
+		return name == p.pattern, nil
+	case p.segments != nil:
+		return matchSegments(p.segments, strings.Split(name, "/"))
+	default:
+		return match(p.pattern, name)
+	}
+}
+
+// artifactIndex holds normalized artifact names sorted for prefix lookups,
+// and the names artifact rules have consumed so far.
+type artifactIndex struct {
+	names    []string
+	consumed map[string]bool
+}
+
+func newArtifactIndex(names []string) *artifactIndex {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+
+	return &artifactIndex{names: sorted, consumed: map[string]bool{}}
+}
+
+// withPrefix returns the names that have not been consumed and start with
+// prefix.
+func (x *artifactIndex) withPrefix(prefix string) []string {
+	names := []string{}
+	for i := sort.SearchStrings(x.names, prefix); i < len(x.names) && strings.HasPrefix(x.names[i], prefix); i++ {
+		if !x.consumed[x.names[i]] {
+			names = append(names, x.names[i])
+		}
+	}
+
+	return names
+}
+
+// filter returns the names that have not been consumed and match pattern.
+func (x *artifactIndex) filter(pattern *artifactPattern) ([]string, error) {
+	filtered := []string{}
+	for _, name := range x.withPrefix(pattern.prefix) {
+		matched, err := pattern.match(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if matched {
+			filtered = append(filtered, name)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (x *artifactIndex) consume(names []string) {
+	for _, name := range names {
+		x.consumed[name] = true
+	}
+}
+
+// destinationArtifacts are the materials and products recorded by a step's
+// claims, keyed by normalized name, for MATCH rules against the step.
+type destinationArtifacts struct {
+	materials map[string][]destinationArtifact
+	products  map[string][]destinationArtifact
+	err       error
+}
+
+// destinationCache holds the destination artifacts of each step, so that
+// they are collected once per verification however many MATCH rules and
+// claims refer to the step. Entries are keyed by the step and its claims.
+type destinationCache struct {
+	mu    sync.Mutex
+	steps map[string]*destinationArtifacts
+}
+
+func (c *destinationCache) get(handlers *artifactHandlers, dstName string, dstClaims map[AttestationIdentifier]*attestationv1.Statement) (*destinationArtifacts, error) {
+	key := destinationKey(dstName, dstClaims)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.steps == nil {
+		c.steps = map[string]*destinationArtifacts{}
+	}
+
+	destination, ok := c.steps[key]
+	if !ok {
+		destination = &destinationArtifacts{}
+		destination.materials, destination.products, destination.err = getDestinationArtifacts(handlers, dstName, dstClaims)
+		c.steps[key] = destination
+	}
+
+	return destination, destination.err
+}
+
+// destinationKey identifies a step's claims by the step's name and the
+// identifier and statement of each claim.
+func destinationKey(dstName string, dstClaims map[AttestationIdentifier]*attestationv1.Statement) string {
+	claims := make([]string, 0, len(dstClaims))
+	for identifier, statement := range dstClaims {
+		claims = append(claims, fmt.Sprintf("%q %q %p", identifier.PredicateType, identifier.Functionary, statement))
+	}
+	sort.Strings(claims)
+
+	return fmt.Sprintf("%q %s", dstName, strings.Join(claims, " "))
+}
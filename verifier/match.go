@@ -8,6 +8,7 @@ package verifier
 
 import (
 	"errors"
+	"path"
 	"unicode/utf8"
 )
 
@@ -223,3 +224,69 @@ func getEsc(chunk string) (r rune, nchunk string, err error) {
 	}
 	return r, nchunk, nil
 }
+
+// Artifact pattern modes. In the legacy mode, patterns are matched with match
+// so '*' matches across path separators like in in-toto v0.9. In the path
+// mode, patterns are matched with matchSegments.
+const (
+	legacyPatternMode = "legacy"
+	pathPatternMode   = "path"
+)
+
+// matchSegments reports whether the '/'-separated segments of a name match
+// those of a pattern, matching each pattern segment with path.Match against
+// the corresponding name segment. A '**' segment matches zero or more
+// segments.
+func matchSegments(patternSegments, nameSegments []string) (bool, error) {
+	// failed records the positions after a '**' segment from which the rest
+	// of the pattern is known not to match, so that patterns with several
+	// '**' segments are not matched in exponential time
+	failed := map[[2]int]bool{}
+
+	var matchFrom func(i, j int) (bool, error)
+	matchFrom = func(i, j int) (bool, error) {
+		for i < len(patternSegments) {
+			if patternSegments[i] == "**" {
+				// collapse consecutive '**' segments
+				for i < len(patternSegments) && patternSegments[i] == "**" {
+					i++
+				}
+				if i == len(patternSegments) {
+					return true, nil
+				}
+
+				for k := j; k <= len(nameSegments); k++ {
+					if failed[[2]int{i, k}] {
+						continue
+					}
+
+					matched, err := matchFrom(i, k)
+					if err != nil || matched {
+						return matched, err
+					}
+					failed[[2]int{i, k}] = true
+				}
+				return false, nil
+			}
+
+			if j == len(nameSegments) {
+				return false, nil
+			}
+
+			matched, err := path.Match(patternSegments[i], nameSegments[j])
+			if err != nil {
+				return false, errBadPattern
+			}
+			if !matched {
+				return false, nil
+			}
+
+			i++
+			j++
+		}
+
+		return j == len(nameSegments), nil
+	}
+
+	return matchFrom(0, 0)
+}
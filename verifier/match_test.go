@@ -0,0 +1,128 @@
+package verifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matched bool
+		err     bool
+	}{
+		{pattern: "foo", name: "foo", matched: true},
+		{pattern: "foo", name: "foo/bar"},
+		{pattern: "*", name: "foo", matched: true},
+		{pattern: "*", name: "foo/bar"},
+		{pattern: "*/bar", name: "foo/bar", matched: true},
+		{pattern: "src/*.go", name: "src/main.go", matched: true},
+		{pattern: "src/*.go", name: "src/cmd/main.go"},
+		{pattern: "src/?.go", name: "src/a.go", matched: true},
+		{pattern: "src/[ab].go", name: "src/c.go"},
+		{pattern: "**", name: "foo", matched: true},
+		{pattern: "**", name: "foo/bar/baz", matched: true},
+		{pattern: "src/**", name: "src", matched: true},
+		{pattern: "src/**", name: "src/cmd/main.go", matched: true},
+		{pattern: "src/**", name: "srcs/main.go"},
+		{pattern: "**/main.go", name: "main.go", matched: true},
+		{pattern: "**/main.go", name: "src/cmd/main.go", matched: true},
+		{pattern: "**/main.go", name: "src/cmd/main.go.orig"},
+		{pattern: "src/**/*.go", name: "src/main.go", matched: true},
+		{pattern: "src/**/*.go", name: "src/a/b/main.go", matched: true},
+		{pattern: "src/**/*.go", name: "src/a/b/main.c"},
+		{pattern: "src/**/**/*.go", name: "src/main.go", matched: true},
+		{pattern: "a/**/b/**/c", name: "a/x/b/y/z/c", matched: true},
+		{pattern: "a/**/b/**/c", name: "a/x/y/c"},
+		{pattern: strings.Repeat("**/a/", 12) + "b", name: strings.Repeat("a/", 60) + "c"},
+		{pattern: strings.Repeat("**/a/", 12) + "b", name: strings.Repeat("a/", 60) + "b", matched: true},
+		{pattern: "src/[", name: "src/a", err: true},
+	}
+
+	for _, test := range tests {
+		p, err := compileArtifactPattern(pathPatternMode, test.pattern)
+		if (err != nil) != test.err {
+			t.Errorf("compileArtifactPattern(%q) error %v, want error %t", test.pattern, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		matched, err := p.match(test.name)
+		if err != nil {
+			t.Errorf("pattern %q matching %q: %s", test.pattern, test.name, err)
+			continue
+		}
+		if matched != test.matched {
+			t.Errorf("pattern %q matching %q = %t, want %t", test.pattern, test.name, matched, test.matched)
+		}
+	}
+}
+
+func TestArtifactPattern(t *testing.T) {
+	tests := []struct {
+		mode    string
+		pattern string
+		prefix  string
+		matches []string
+		misses  []string
+	}{
+		{
+			mode:    legacyPatternMode,
+			pattern: "src/*",
+			prefix:  "src/",
+			matches: []string{"src/main.go", "src/cmd/main.go"},
+			misses:  []string{"src", "main.go"},
+		},
+		{
+			mode:    pathPatternMode,
+			pattern: "src/*",
+			prefix:  "src",
+			matches: []string{"src/main.go"},
+			misses:  []string{"src/cmd/main.go", "main.go"},
+		},
+		{
+			mode:    pathPatternMode,
+			pattern: "src/**",
+			prefix:  "src",
+			matches: []string{"src", "src/cmd/main.go"},
+			misses:  []string{"main.go"},
+		},
+		{
+			mode:    pathPatternMode,
+			pattern: "bin/foo",
+			prefix:  "bin/foo",
+			matches: []string{"bin/foo"},
+			misses:  []string{"bin/foo/bar", "bin/fo"},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := compileArtifactPattern(test.mode, test.pattern)
+		if err != nil {
+			t.Fatalf("compileArtifactPattern(%q, %q): %s", test.mode, test.pattern, err)
+		}
+		if p.prefix != test.prefix {
+			t.Errorf("%s pattern %q has prefix %q, want %q", test.mode, test.pattern, p.prefix, test.prefix)
+		}
+
+		for _, name := range test.matches {
+			if matched, err := p.match(name); err != nil || !matched {
+				t.Errorf("%s pattern %q does not match %q (%v)", test.mode, test.pattern, name, err)
+			}
+		}
+		for _, name := range test.misses {
+			if matched, err := p.match(name); err != nil || matched {
+				t.Errorf("%s pattern %q matches %q (%v)", test.mode, test.pattern, name, err)
+			}
+		}
+	}
+
+	for _, mode := range []string{legacyPatternMode, pathPatternMode} {
+		if _, err := compileArtifactPattern(mode, "src/["); err == nil {
+			t.Errorf("%s pattern with unterminated class compiled", mode)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
+)
+
+// missingField evaluates the expression against input again, tracking the
+// value of each sub-expression, to find what its evaluation error came from.
+// It returns the field or variable the expression looked up, if the error is
+// the result of the input not recording it. Errors of any other kind, such
+// as type mismatches or indexes out of range, return an empty string. Errors
+// raised by a lookup using comprehension variables, e.g. inside all() or
+// exists(), cannot be attributed and are returned as an error instead.
+func (c *programCache) missingField(ctx context.Context, expression string, input interpreter.Activation) (string, error) {
+	checked, program, err := c.trackedProgram(expression)
+	if err != nil {
+		return "", err
+	}
+
+	_, details, evalErr := program.ContextEval(ctx, input)
+	if err := checkContext(ctx); err != nil {
+		return "", err
+	}
+	if details == nil || details.State() == nil {
+		return "", nil
+	}
+
+	lookups := &missingLookups{
+		ctx:       ctx,
+		env:       c.env,
+		costLimit: c.costLimit,
+		info:      checked.NativeRep().SourceInfo(),
+		state:     details.State(),
+		input:     input,
+	}
+	lookup, err := lookups.find(checked.NativeRep().Expr(), nil)
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", evalErr, err)
+	}
+	if lookup == nil {
+		return "", nil
+	}
+
+	return parser.Unparse(lookup, checked.NativeRep().SourceInfo())
+}
+
+// trackedProgram returns the expression compiled to record the value of each
+// sub-expression when evaluated.
+func (c *programCache) trackedProgram(expression string) (*cel.Ast, cel.Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if tracked, ok := c.tracked[expression]; ok {
+		return tracked.ast, tracked.program, nil
+	}
+
+	checked, issues := c.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, nil, issues.Err()
+	}
+
+	programOptions := []cel.ProgramOption{
+		cel.EvalOptions(cel.OptTrackState),
+		cel.InterruptCheckFrequency(1),
+	}
+	if c.costLimit > 0 {
+		programOptions = append(programOptions, cel.CostLimit(c.costLimit))
+	}
+
+	program, err := c.env.Program(checked, programOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.cached[expression] {
+		c.tracked[expression] = &trackedProgram{ast: checked, program: program}
+	}
+
+	return checked, program, nil
+}
+
+// trackedProgram is a compiled expression that records the value of each
+// sub-expression.
+type trackedProgram struct {
+	ast     *cel.Ast
+	program cel.Program
+}
+
+// missingLookups finds the lookup an evaluation error came from, using the
+// values recorded during the evaluation.
+type missingLookups struct {
+	ctx       context.Context
+	env       *cel.Env
+	costLimit uint64
+	info      *ast.SourceInfo
+	state     interpreter.EvalState
+	input     interpreter.Activation
+}
+
+// errComprehensionLookup is returned when the lookup an evaluation error
+// came from uses comprehension variables. Their values are only bound inside
+// the comprehension, and the values recorded are those of the last iteration
+// only, so which field is missing cannot be determined.
+var errComprehensionLookup = errors.New("unable to determine the missing field inside a comprehension")
+
+// find follows the evaluation error of expr down to the sub-expression it was
+// raised by. That sub-expression is returned if it is the lookup of a map key
+// or variable the input does not record, and nil is returned otherwise. scope
+// holds the comprehension variables bound where expr is evaluated.
+func (l *missingLookups) find(expr ast.Expr, scope map[string]bool) (ast.Expr, error) {
+	value, ok := l.state.Value(expr.ID())
+	if !ok || !types.IsError(value) {
+		return nil, nil
+	}
+
+	missing, err := l.missing(expr, scope)
+	if missing != nil || err != nil {
+		return missing, err
+	}
+
+	children := childExprs(expr)
+	childScopes := make([]map[string]bool, len(children))
+	for i := range childScopes {
+		childScopes[i] = scope
+	}
+	if expr.Kind() == ast.ComprehensionKind {
+		comprehension := expr.AsComprehension()
+		loopScope := map[string]bool{comprehension.IterVar(): true, comprehension.AccuVar(): true}
+		for name := range scope {
+			loopScope[name] = true
+		}
+		children = append(children, comprehension.LoopStep(), comprehension.Result())
+		childScopes = append(childScopes, loopScope, loopScope)
+	}
+
+	// An error raised by an operand is passed on unchanged, so the operand
+	// it came from holds the same error. An error held by a comprehension
+	// variable, such as the accumulator of all(), may have been raised in
+	// any iteration, and operands whose value cannot be determined may hold
+	// it too, so these fail the search if no other operand holds the error.
+	var undetermined error
+	for i, child := range children {
+		childValue, ok, err := l.value(child, childScopes[i])
+		if err != nil {
+			undetermined = err
+			continue
+		}
+		if !ok || !types.IsError(childValue) || fmt.Sprint(childValue.Value()) != fmt.Sprint(value.Value()) {
+			continue
+		}
+		if child.Kind() == ast.IdentKind && childScopes[i][child.AsIdent()] {
+			undetermined = errComprehensionLookup
+			continue
+		}
+
+		return l.find(child, childScopes[i])
+	}
+
+	return nil, undetermined
+}
+
+// missing returns the lookup in expr of a map key or variable missing from
+// the input, if expr is a field selection, index or variable. Variables and
+// field selections on them are evaluated as one attribute that fails as a
+// whole, so a failed operand is checked in turn.
+func (l *missingLookups) missing(expr ast.Expr, scope map[string]bool) (ast.Expr, error) {
+	var operand ast.Expr
+	var key ref.Val
+
+	switch expr.Kind() {
+	case ast.IdentKind:
+		if scope[expr.AsIdent()] {
+			return nil, errComprehensionLookup
+		}
+		if _, found := l.input.ResolveName(expr.AsIdent()); !found {
+			return expr, nil
+		}
+		return nil, nil
+	case ast.SelectKind:
+		if expr.AsSelect().IsTestOnly() {
+			return nil, nil
+		}
+
+		operand = expr.AsSelect().Operand()
+		if usesVariables(operand, scope) {
+			return nil, errComprehensionLookup
+		}
+		key = types.String(expr.AsSelect().FieldName())
+	case ast.CallKind:
+		call := expr.AsCall()
+		if call.FunctionName() != "_[_]" || len(call.Args()) != 2 {
+			return nil, nil
+		}
+
+		operand = call.Args()[0]
+		if usesVariables(expr, scope) {
+			return nil, errComprehensionLookup
+		}
+		if index := call.Args()[1]; index.Kind() == ast.LiteralKind {
+			key = index.AsLiteral()
+		} else if indexValue, ok, err := l.value(index, scope); err != nil {
+			return nil, err
+		} else if ok && !types.IsError(indexValue) {
+			key = indexValue
+		} else {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	value, ok, err := l.value(operand, scope)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if types.IsError(value) {
+		return l.missing(operand, scope)
+	}
+
+	// Looking up a field in anything but a map fails for reasons other than
+	// the field being absent
+	mapper, ok := value.(traits.Mapper)
+	if !ok {
+		return nil, nil
+	}
+	if _, found := mapper.Find(key); found {
+		return nil, nil
+	}
+
+	return expr, nil
+}
+
+// value returns the value expr evaluated to. Variables and field selections
+// on them are resolved as one attribute, so their values are not recorded
+// separately and are evaluated again here. Expressions using comprehension
+// variables in scope cannot be evaluated outside the comprehension and
+// return errComprehensionLookup.
+func (l *missingLookups) value(expr ast.Expr, scope map[string]bool) (ref.Val, bool, error) {
+	if value, ok := l.state.Value(expr.ID()); ok {
+		return value, true, nil
+	}
+
+	if usesVariables(expr, scope) {
+		return nil, false, errComprehensionLookup
+	}
+
+	text, err := parser.Unparse(expr, l.info)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	checked, issues := l.env.Compile(text)
+	if issues != nil && issues.Err() != nil {
+		return nil, false, nil
+	}
+
+	programOptions := []cel.ProgramOption{cel.InterruptCheckFrequency(1)}
+	if l.costLimit > 0 {
+		programOptions = append(programOptions, cel.CostLimit(l.costLimit))
+	}
+
+	program, err := l.env.Program(checked, programOptions...)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	// Failed evaluations return the error as the value as well
+	value, _, _ := program.ContextEval(l.ctx, l.input)
+
+	return value, value != nil, nil
+}
+
+// usesVariables reports whether expr refers to any of the variables.
+func usesVariables(expr ast.Expr, variables map[string]bool) bool {
+	if len(variables) == 0 {
+		return false
+	}
+	if expr.Kind() == ast.IdentKind {
+		return variables[expr.AsIdent()]
+	}
+
+	children := childExprs(expr)
+	if expr.Kind() == ast.ComprehensionKind {
+		comprehension := expr.AsComprehension()
+		children = append(children, comprehension.AccuInit(), comprehension.LoopCondition(), comprehension.LoopStep(), comprehension.Result())
+	}
+	for _, child := range children {
+		if usesVariables(child, variables) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/interpreter"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestMissingField(t *testing.T) {
+	env, err := getCELEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	programs := &programCache{env: env, programs: map[string]cel.Program{}, tracked: map[string]*trackedProgram{}}
+
+	predicate, err := structpb.NewStruct(map[string]any{
+		"builder": map[string]any{"id": "https://example.com/builder"},
+		"materials": []any{
+			map[string]any{"uri": "git+https://example.com/repo"},
+			map[string]any{"uri": "https://example.com/foo.tar.gz", "digest": map[string]any{"sha256": "aa"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := interpreter.NewActivation(map[string]any{
+		"predicateType": "https://slsa.dev/provenance/v1",
+		"predicate":     predicate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		missing string
+		err     error
+	}{
+		{name: "field", rule: "predicate.buildType == 'make'", missing: "predicate.buildType"},
+		{name: "nested field", rule: "predicate.invocation.parameters == 'x'", missing: "predicate.invocation"},
+		{name: "index", rule: "predicate['buildType'] == 'make'", missing: `predicate["buildType"]`},
+		{name: "nested index", rule: "predicate.builder['version'] == '1'", missing: `predicate.builder["version"]`},
+		{name: "undeclared variable", rule: "subject.size() > 0", missing: "subject"},
+		{name: "operand of a comparison", rule: "predicateType != '' && predicate.buildType == 'make'", missing: "predicate.buildType"},
+		{name: "type mismatch", rule: "predicate.builder.id + 1 == 2"},
+		{name: "index out of range", rule: "predicate.materials[5].uri == ''"},
+		{name: "field of a list", rule: "predicate.materials.uri == ''"},
+		{name: "field in all()", rule: "predicate.materials.all(m, m.digest.sha256 != '')", err: errComprehensionLookup},
+		{name: "index in all()", rule: "predicate.materials.all(m, m['digest'].sha256 != '')", err: errComprehensionLookup},
+		{name: "field in exists()", rule: "predicate.materials.exists(m, m.digest.sha256 == 'bb')", err: errComprehensionLookup},
+		{name: "field outside the comprehension", rule: "predicate.materials.all(m, m.uri != '' && predicate.buildType == 'make')", missing: "predicate.buildType"},
+		{name: "comprehension over a missing field", rule: "predicate.byproducts.all(b, b.uri != '')", missing: "predicate.byproducts"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			missing, err := programs.missingField(context.Background(), test.rule, input)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if missing != test.missing {
+				t.Errorf("missing %q, want %q", missing, test.missing)
+			}
+		})
+	}
+}
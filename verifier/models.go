@@ -6,68 +6,108 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// copied from go-sslib to use yaml tags
+// copied from go-sslib to use yaml tags, extended with key groups. ValidFrom
+// and ValidUntil are rejected, see checkNoValidity.
 type Functionary struct {
-	KeyIDHashAlgorithms []string `yaml:"keyIDHashAlgorithms"`
-	KeyType             string   `yaml:"keyType"`
-	KeyVal              KeyVal   `yaml:"keyVal"`
-	Scheme              string   `yaml:"scheme"`
-	KeyID               string   `yaml:"keyID"`
+	KeyIDHashAlgorithms []string      `yaml:"keyIDHashAlgorithms,omitempty"`
+	KeyType             string        `yaml:"keyType,omitempty"`
+	KeyVal              KeyVal        `yaml:"keyVal,omitempty"`
+	Scheme              string        `yaml:"scheme,omitempty"`
+	KeyID               string        `yaml:"keyID,omitempty"`
+	ValidFrom           string        `yaml:"validFrom,omitempty"`
+	ValidUntil          string        `yaml:"validUntil,omitempty"`
+	Keys                []Functionary `yaml:"keys,omitempty"`
 }
 
 type KeyVal struct {
-	Public string `yaml:"public"`
+	Public string `yaml:"public,omitempty"`
 }
 
 type Constraint struct {
-	Rule           string `yaml:"rule"`
-	AllowIfNoClaim bool   `yaml:"allowIfNoClaim"`
-	Warn           bool   `yaml:"warn"`
-	Debug          string `yaml:"debug"`
+	Rule           string `yaml:"rule,omitempty"`
+	AllowIfNoClaim bool   `yaml:"allowIfNoClaim,omitempty"`
+	Warn           bool   `yaml:"warn,omitempty"`
+	Debug          string `yaml:"debug,omitempty"`
 }
 
 type ExpectedStepPredicates struct {
-	PredicateType      string       `yaml:"predicateType"`
-	ExpectedAttributes []Constraint `yaml:"expectedAttributes"`
-	Functionaries      []string     `yaml:"functionaries"`
-	Threshold          int          `yaml:"threshold"`
+	PredicateType       string       `yaml:"predicateType,omitempty"`
+	ExpectedAttributes  []Constraint `yaml:"expectedAttributes,omitempty"`
+	Functionaries       []string     `yaml:"functionaries,omitempty"`
+	Threshold           int          `yaml:"threshold,omitempty"`
+	MaterialsExpression string       `yaml:"materialsExpression,omitempty"`
+	ProductsExpression  string       `yaml:"productsExpression,omitempty"`
+
+	// SubjectMatchesProductsOf names a step whose products must include
+	// every artifact in the claim's subject.
+	SubjectMatchesProductsOf string `yaml:"subjectMatchesProductsOf,omitempty"`
 }
 
 type Step struct {
-	Name               string                   `yaml:"name"`
-	Command            string                   `yaml:"command"`
-	ExpectedMaterials  []string                 `yaml:"expectedMaterials"`
-	ExpectedProducts   []string                 `yaml:"expectedProducts"`
-	ExpectedPredicates []ExpectedStepPredicates `yaml:"expectedPredicates"`
+	Name               string                   `yaml:"name,omitempty"`
+	Command            string                   `yaml:"command,omitempty"`
+	CommandArgs        []string                 `yaml:"commandArgs,omitempty"`
+	CommandMatch       string                   `yaml:"commandMatch,omitempty"`
+	CommandWarn        bool                     `yaml:"commandWarn,omitempty"`
+	ExpectedMaterials  []string                 `yaml:"expectedMaterials,omitempty"`
+	ExpectedProducts   []string                 `yaml:"expectedProducts,omitempty"`
+	ExpectedPredicates []ExpectedStepPredicates `yaml:"expectedPredicates,omitempty"`
+	MatchQuorum        int                      `yaml:"matchQuorum,omitempty"`
+	ExpectedVSA        *ExpectedVSA             `yaml:"expectedVSA,omitempty"`
+}
+
+// ExpectedVSA accepts verification summaries issued by trusted verifiers in
+// place of the claims of a step.
+type ExpectedVSA struct {
+	Functionaries  []string          `yaml:"functionaries,omitempty"`
+	Threshold      int               `yaml:"threshold,omitempty"`
+	VerifierID     string            `yaml:"verifierID,omitempty"`
+	PolicyURI      string            `yaml:"policyURI,omitempty"`
+	PolicyDigest   map[string]string `yaml:"policyDigest,omitempty"`
+	VerifiedLevels []string          `yaml:"verifiedLevels,omitempty"`
+	SubjectDigests []string          `yaml:"subjectDigests,omitempty"`
 }
 
 type ExpectedSubjectPredicates struct {
-	PredicateType      string       `yaml:"predicateType"`
-	ExpectedAttributes []Constraint `yaml:"expectedAttributes"`
-	Functionaries      []string     `yaml:"functionaries"`
-	Threshold          int          `yaml:"threshold"`
+	PredicateType      string       `yaml:"predicateType,omitempty"`
+	ExpectedAttributes []Constraint `yaml:"expectedAttributes,omitempty"`
+	Functionaries      []string     `yaml:"functionaries,omitempty"`
+	Threshold          int          `yaml:"threshold,omitempty"`
 }
 
 type Subject struct {
-	Subject            []string                    `yaml:"subject"`
-	ExpectedPredicates []ExpectedSubjectPredicates `yaml:"expectedPredicates"`
+	Subject            []string                    `yaml:"subject,omitempty"`
+	ExpectedPredicates []ExpectedSubjectPredicates `yaml:"expectedPredicates,omitempty"`
 }
 
 type Inspection struct {
-	Name               string       `yaml:"name"`
-	Command            string       `yaml:"command"`
-	Predicates         []string     `yaml:"predicates"`
-	ExpectedMaterials  []string     `yaml:"expectedMaterials"`
-	ExpectedProducts   []string     `yaml:"expectedProducts"`
-	ExpectedAttributes []Constraint `yaml:"expectedAttributes"`
+	Name               string       `yaml:"name,omitempty"`
+	Command            string       `yaml:"command,omitempty"`
+	Predicates         []string     `yaml:"predicates,omitempty"`
+	ExpectedMaterials  []string     `yaml:"expectedMaterials,omitempty"`
+	ExpectedProducts   []string     `yaml:"expectedProducts,omitempty"`
+	ExpectedAttributes []Constraint `yaml:"expectedAttributes,omitempty"`
+}
+
+type RevocationPolicy struct {
+	Functionaries []string `yaml:"functionaries,omitempty"`
+	Threshold     int      `yaml:"threshold,omitempty"`
+}
+
+type DigestPolicy struct {
+	AcceptedAlgorithms []string `yaml:"acceptedAlgorithms,omitempty"`
+	MinimumStrength    string   `yaml:"minimumStrength,omitempty"`
 }
 
 type Layout struct {
-	Expires       string                 `yaml:"expires"`
-	Functionaries map[string]Functionary `yaml:"functionaries"`
-	Steps         []*Step                `yaml:"steps"`
-	Subjects      []*Subject             `yaml:"subjects"`
-	Inspections   []*Inspection          `yaml:"inspections"`
+	Expires             string                 `yaml:"expires,omitempty"`
+	Functionaries       map[string]Functionary `yaml:"functionaries,omitempty"`
+	Steps               []*Step                `yaml:"steps,omitempty"`
+	Subjects            []*Subject             `yaml:"subjects,omitempty"`
+	Inspections         []*Inspection          `yaml:"inspections,omitempty"`
+	Revocations         *RevocationPolicy      `yaml:"revocations,omitempty"`
+	ArtifactPatternMode string                 `yaml:"artifactPatternMode,omitempty"`
+	DigestPolicy        *DigestPolicy          `yaml:"digestPolicy,omitempty"`
 }
 
 func LoadLayout(path string) (*Layout, error) {
@@ -76,6 +116,11 @@ func LoadLayout(path string) (*Layout, error) {
 		return nil, err
 	}
 
+	return ParseLayout(layoutBytes)
+}
+
+// ParseLayout parses a YAML or JSON layout.
+func ParseLayout(layoutBytes []byte) (*Layout, error) {
 	layout := &Layout{}
 	if err := yaml.Unmarshal(layoutBytes, layout); err != nil {
 		return nil, err
@@ -0,0 +1,151 @@
+package verifier
+
+import (
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	log "github.com/sirupsen/logrus"
+)
+
+type verifyOptions struct {
+	revocations *RevocationList
+	links       map[string]in_toto.Metadata
+	registry    *PredicateRegistry
+
+	vulnExceptions *VulnerabilityExceptions
+	vexDocuments   []*VEXDocument
+
+	logger  log.FieldLogger
+	clock   func() time.Time
+	sources []AttestationSource
+	limits  Limits
+
+	concurrency int
+	lazy        bool
+	cache       *DiskCache
+	explain     bool
+}
+
+// Option configures optional inputs to Verify.
+type Option func(*verifyOptions)
+
+// Limits bounds the work done for a single verification. Zero values leave
+// the corresponding limit unset.
+type Limits struct {
+	// MaxAttestations is the maximum number of attestations and links
+	// considered in a verification.
+	MaxAttestations int
+
+	// MaxPayloadBytes is the maximum decoded size of an attestation's payload.
+	MaxPayloadBytes int
+
+	// CELCostLimit is the maximum cost of evaluating a single CEL expression.
+	CELCostLimit uint64
+}
+
+// WithRevocationList makes Verify reject signatures by revoked keys and
+// attestations listed as revoked.
+func WithRevocationList(revocations *RevocationList) Option {
+	return func(o *verifyOptions) {
+		o.revocations = revocations
+	}
+}
+
+// WithLinks adds signed in-toto v0.9 links to the claims considered by
+// Verify. Links are attributed to the step named in the link.
+func WithLinks(links map[string]in_toto.Metadata) Option {
+	return func(o *verifyOptions) {
+		o.links = links
+	}
+}
+
+// WithPredicateRegistry sets the predicate handlers used by Verify in place of
+// the handlers registered with RegisterPredicateHandler.
+func WithPredicateRegistry(registry *PredicateRegistry) Option {
+	return func(o *verifyOptions) {
+		o.registry = registry
+	}
+}
+
+// WithVulnerabilityExceptions suppresses the listed findings in vulnerability
+// scans until the exceptions expire.
+func WithVulnerabilityExceptions(exceptions *VulnerabilityExceptions) Option {
+	return func(o *verifyOptions) {
+		o.vulnExceptions = exceptions
+	}
+}
+
+// WithVEXDocuments suppresses findings in vulnerability scans that the
+// documents' statements mark as not_affected or fixed for the scanned
+// artifacts.
+func WithVEXDocuments(documents ...*VEXDocument) Option {
+	return func(o *verifyOptions) {
+		o.vexDocuments = append(o.vexDocuments, documents...)
+	}
+}
+
+// WithLogger sets the logger used to report progress, in place of the
+// standard logrus logger.
+func WithLogger(logger log.FieldLogger) Option {
+	return func(o *verifyOptions) {
+		o.logger = logger
+	}
+}
+
+// WithClock sets the function returning the time that layout expiry,
+// revocations and exceptions are checked against.
+func WithClock(clock func() time.Time) Option {
+	return func(o *verifyOptions) {
+		o.clock = clock
+	}
+}
+
+// WithAttestationSource adds sources whose attestations are verified along
+// with those passed to Verify.
+func WithAttestationSource(sources ...AttestationSource) Option {
+	return func(o *verifyOptions) {
+		o.sources = append(o.sources, sources...)
+	}
+}
+
+// WithLimits bounds the work done for each verification.
+func WithLimits(limits Limits) Option {
+	return func(o *verifyOptions) {
+		o.limits = limits
+	}
+}
+
+// WithConcurrency sets the number of signatures and claims verified at once,
+// which defaults to GOMAXPROCS.
+func WithConcurrency(concurrency int) Option {
+	return func(o *verifyOptions) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithLazyVerification skips verifying attestations and links for steps the
+// layout does not use, so that a malformed or unsigned attestation it never
+// needed cannot fail verification. Skipped attestations are listed in the
+// result as unused.
+func WithLazyVerification() Option {
+	return func(o *verifyOptions) {
+		o.lazy = true
+	}
+}
+
+// WithDiskCache reuses verification results and signature checks stored in
+// the cache, and stores new ones.
+func WithDiskCache(cache *DiskCache) Option {
+	return func(o *verifyOptions) {
+		o.cache = cache
+	}
+}
+
+// WithExplain adds the value of each sub-expression of a failed attribute
+// rule to its error, along with the nearest existing field when a field
+// lookup fails.
+func WithExplain() Option {
+	return func(o *verifyOptions) {
+		o.explain = true
+	}
+}
@@ -0,0 +1,32 @@
+package verifier
+
+import "sync"
+
+// parallelize calls fn for each index below count, with at most concurrency
+// calls running at once.
+func parallelize(concurrency, count int, fn func(int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > count {
+		concurrency = count
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,323 @@
+package verifier
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// parameterPattern matches parameter references, such as {github_ref}.
+var parameterPattern = regexp.MustCompile(`\{([a-zA-Z0-9_-]+)\}`)
+
+// parameterNamePattern matches valid parameter names.
+var parameterNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// Kinds of layout fields parameters are substituted in. Values are escaped
+// so that they cannot change the structure of CEL expressions or artifact
+// rules.
+const (
+	textParameterField = iota
+	celParameterField
+	artifactRuleParameterField
+)
+
+// ParameterNames returns the sorted names of the parameters the layout refers
+// to.
+func ParameterNames(layout *Layout) []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	// Fields are returned unchanged, so the walk cannot fail
+	_ = walkParameterFields(layout, func(_ int, field string) (string, error) {
+		for _, match := range parameterPattern.FindAllStringSubmatch(field, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+
+		return field, nil
+	})
+	sort.Strings(names)
+
+	return names
+}
+
+func substituteParameters(layout *Layout, parameters map[string]string) (*Layout, error) {
+	resolved, err := resolveParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkParameterFields(layout, func(kind int, field string) (string, error) {
+		switch kind {
+		case celParameterField:
+			return substituteCELParameters(field, resolved)
+		case artifactRuleParameterField:
+			return substituteArtifactRuleParameters(field, resolved)
+		default:
+			return parameterPattern.ReplaceAllStringFunc(field, func(reference string) string {
+				if value, ok := resolved[reference[1:len(reference)-1]]; ok {
+					return value
+				}
+				return reference
+			}), nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// walkParameterFields replaces each layout field parameters can be
+// substituted in with the result of substitute.
+func walkParameterFields(layout *Layout, substitute func(kind int, field string) (string, error)) error {
+	var err error
+	replace := func(kind int, field *string) {
+		if err == nil {
+			*field, err = substitute(kind, *field)
+		}
+	}
+
+	for _, step := range layout.Steps {
+		replace(textParameterField, &step.Command)
+		for i := range step.CommandArgs {
+			replace(textParameterField, &step.CommandArgs[i])
+		}
+
+		for i := range step.ExpectedMaterials {
+			replace(artifactRuleParameterField, &step.ExpectedMaterials[i])
+		}
+
+		for i := range step.ExpectedProducts {
+			replace(artifactRuleParameterField, &step.ExpectedProducts[i])
+		}
+
+		if step.ExpectedVSA != nil {
+			replace(textParameterField, &step.ExpectedVSA.VerifierID)
+			replace(textParameterField, &step.ExpectedVSA.PolicyURI)
+			for algorithm, digest := range step.ExpectedVSA.PolicyDigest {
+				replace(textParameterField, &digest)
+				step.ExpectedVSA.PolicyDigest[algorithm] = digest
+			}
+			for i := range step.ExpectedVSA.VerifiedLevels {
+				replace(textParameterField, &step.ExpectedVSA.VerifiedLevels[i])
+			}
+			for i := range step.ExpectedVSA.SubjectDigests {
+				replace(textParameterField, &step.ExpectedVSA.SubjectDigests[i])
+			}
+		}
+
+		for i := range step.ExpectedPredicates {
+			expectedPredicate := &step.ExpectedPredicates[i]
+			replace(celParameterField, &expectedPredicate.MaterialsExpression)
+			replace(celParameterField, &expectedPredicate.ProductsExpression)
+			replace(textParameterField, &expectedPredicate.SubjectMatchesProductsOf)
+
+			for j := range expectedPredicate.ExpectedAttributes {
+				replace(celParameterField, &expectedPredicate.ExpectedAttributes[j].Rule)
+				replace(textParameterField, &expectedPredicate.ExpectedAttributes[j].Debug)
+			}
+		}
+	}
+
+	return err
+}
+
+// resolveParameters checks the parameter names and substitutes parameters
+// referred to in the values of others.
+func resolveParameters(parameters map[string]string) (map[string]string, error) {
+	resolved := map[string]string{}
+	for parameter, value := range parameters {
+		if !parameterNamePattern.MatchString(parameter) {
+			return nil, fmt.Errorf("invalid parameter format")
+		}
+
+		if strings.Contains(value, fmt.Sprintf("{%s}", parameter)) {
+			return nil, fmt.Errorf("parameter's value refers to itself")
+		}
+
+		resolved[parameter] = value
+	}
+
+	// Each pass resolves one more level of references, so references left
+	// after one pass per parameter form a cycle
+	for pass := 0; pass <= len(resolved); pass++ {
+		unresolved := false
+		for parameter, value := range resolved {
+			resolved[parameter] = parameterPattern.ReplaceAllStringFunc(value, func(reference string) string {
+				if other, ok := resolved[reference[1:len(reference)-1]]; ok {
+					unresolved = true
+					return other
+				}
+				return reference
+			})
+		}
+
+		if !unresolved {
+			return resolved, nil
+		}
+	}
+
+	return nil, fmt.Errorf("parameters refer to each other in a cycle")
+}
+
+// substituteCELParameters substitutes parameters in a CEL expression as
+// string values. References in string literals are replaced with the escaped
+// value, and references elsewhere with a string literal holding the value,
+// so a value can never be read as CEL.
+func substituteCELParameters(expression string, parameters map[string]string) (string, error) {
+	var b strings.Builder
+
+	// delimiter is the quote sequence closing the current string literal,
+	// and empty outside string literals
+	delimiter := ""
+	raw := false
+
+	for i := 0; i < len(expression); {
+		if reference := parameterPattern.FindStringSubmatchIndex(expression[i:]); reference != nil && reference[0] == 0 {
+			name := expression[i+reference[2] : i+reference[3]]
+			if value, ok := parameters[name]; ok {
+				switch {
+				case delimiter == "":
+					b.WriteString(`"` + escapeCELString(value, '"') + `"`)
+				case raw:
+					if strings.ContainsAny(value, delimiter[:1]+"\r\n") {
+						return "", fmt.Errorf("value of parameter %s cannot be used in a raw string literal", name)
+					}
+					b.WriteString(value)
+				default:
+					b.WriteString(escapeCELString(value, delimiter[0]))
+				}
+
+				i += reference[1]
+				continue
+			}
+		}
+
+		c := expression[i]
+		switch {
+		case delimiter == "" && (c == '\'' || c == '"'):
+			delimiter = string(c)
+			if strings.HasPrefix(expression[i:], strings.Repeat(string(c), 3)) {
+				delimiter = strings.Repeat(string(c), 3)
+			}
+			raw = isRawStringPrefix(expression[:i])
+
+			b.WriteString(delimiter)
+			i += len(delimiter)
+		case delimiter != "" && !raw && c == '\\' && i+1 < len(expression):
+			b.WriteString(expression[i : i+2])
+			i += 2
+		case delimiter != "" && strings.HasPrefix(expression[i:], delimiter):
+			b.WriteString(delimiter)
+			i += len(delimiter)
+			delimiter = ""
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// isRawStringPrefix reports whether a string literal following text is raw,
+// that is whether text ends with an r prefix, optionally combined with a b
+// prefix.
+func isRawStringPrefix(text string) bool {
+	prefix := ""
+	for i := len(text) - 1; i >= 0 && len(prefix) < 3 && strings.ContainsRune("rRbB", rune(text[i])); i-- {
+		prefix = text[i:]
+	}
+	if prefix == "" || len(prefix) > 2 {
+		return false
+	}
+
+	// The prefix must not be the end of an identifier
+	if start := len(text) - len(prefix); start > 0 {
+		previous := rune(text[start-1])
+		if previous == '_' || unicode.IsLetter(previous) || unicode.IsDigit(previous) {
+			return false
+		}
+	}
+
+	return strings.ContainsAny(prefix, "rR")
+}
+
+// escapeCELString escapes value for use in a CEL string literal delimited by
+// quote.
+func escapeCELString(value string, quote byte) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == rune(quote):
+			b.WriteString(`\` + string(r))
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// substituteArtifactRuleParameters substitutes parameters in each token of
+// an artifact rule. Values must not contain whitespace, which separates the
+// tokens, and wildcards in values are escaped in the rule's pattern.
+func substituteArtifactRuleParameters(rule string, parameters map[string]string) (string, error) {
+	tokens := strings.Split(rule, " ")
+	for i, token := range tokens {
+		var err error
+		tokens[i] = parameterPattern.ReplaceAllStringFunc(token, func(reference string) string {
+			name := reference[1 : len(reference)-1]
+			value, ok := parameters[name]
+			if !ok {
+				return reference
+			}
+
+			if strings.IndexFunc(value, unicode.IsSpace) != -1 {
+				err = fmt.Errorf("value of parameter %s used in artifact rule '%s' contains whitespace", name, rule)
+			}
+
+			// The second token of every rule is its pattern
+			if i == 1 {
+				return escapeArtifactPattern(value)
+			}
+
+			return value
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.Join(tokens, " "), nil
+}
+
+// escapeArtifactPattern escapes the wildcards in value, so that it only
+// matches itself as part of an artifact pattern.
+func escapeArtifactPattern(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,220 @@
+package verifier
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/interpreter"
+)
+
+func TestSubstituteCELParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		parameters map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "single quoted",
+			expression: "predicate.ref == '{ref}'",
+			parameters: map[string]string{"ref": "refs/heads/main"},
+			want:       "predicate.ref == 'refs/heads/main'",
+		},
+		{
+			name:       "quote in value",
+			expression: "predicate.ref == '{ref}'",
+			parameters: map[string]string{"ref": "evil' || 'a' == 'a"},
+			want:       `predicate.ref == 'evil\' || \'a\' == \'a'`,
+		},
+		{
+			name:       "backslash in value",
+			expression: `predicate.ref == "{ref}"`,
+			parameters: map[string]string{"ref": `a\" || true || "`},
+			want:       `predicate.ref == "a\\\" || true || \""`,
+		},
+		{
+			name:       "outside string literal",
+			expression: "predicate.count == {count}",
+			parameters: map[string]string{"count": "1 || true"},
+			want:       `predicate.count == "1 || true"`,
+		},
+		{
+			name:       "triple quoted",
+			expression: "predicate.ref == '''{ref}'''",
+			parameters: map[string]string{"ref": "a'''b"},
+			want:       `predicate.ref == '''a\'\'\'b'''`,
+		},
+		{
+			name:       "raw string",
+			expression: "predicate.ref.matches(r'{ref}')",
+			parameters: map[string]string{"ref": `^v\d+$`},
+			want:       `predicate.ref.matches(r'^v\d+$')`,
+		},
+		{
+			name:       "quote in raw string",
+			expression: "predicate.ref.matches(r'{ref}')",
+			parameters: map[string]string{"ref": "a' || true || '"},
+			wantErr:    true,
+		},
+		{
+			name:       "escaped quote before reference",
+			expression: `predicate.ref == 'it\'s {ref}'`,
+			parameters: map[string]string{"ref": "x'"},
+			want:       `predicate.ref == 'it\'s x\''`,
+		},
+		{
+			name:       "unknown parameter",
+			expression: "predicate.ref == '{other}'",
+			parameters: map[string]string{"ref": "x"},
+			want:       "predicate.ref == '{other}'",
+		},
+		{
+			name:       "newline in value",
+			expression: "predicate.ref == '{ref}'",
+			parameters: map[string]string{"ref": "a\nb"},
+			want:       `predicate.ref == 'a\nb'`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := substituteCELParameters(test.expression, test.parameters)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubstitutedRuleCannotBeInjected(t *testing.T) {
+	env, err := getCELEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	programs := &programCache{env: env, programs: map[string]cel.Program{}, tracked: map[string]*trackedProgram{}}
+
+	input, err := interpreter.NewActivation(map[string]any{"predicateType": "https://example.com/real"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"evil' || 'a' == 'a", `evil" || "a" == "a`, `evil\' || true || \'`} {
+		for _, rule := range []string{"predicateType == '{type}'", `predicateType == "{type}"`, "predicateType == {type}"} {
+			substituted, err := substituteCELParameters(rule, map[string]string{"type": value})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			program, err := programs.program(substituted)
+			if err != nil {
+				t.Fatalf("rule %s: %s", substituted, err)
+			}
+
+			out, _, err := program.Eval(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Value() != false {
+				t.Errorf("rule %s passed", substituted)
+			}
+		}
+	}
+}
+
+func TestSubstituteArtifactRuleParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       string
+		parameters map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "pattern",
+			rule:       "CREATE pkg:npm/{name}@{version}",
+			parameters: map[string]string{"name": "sigstore", "version": "1.0.0"},
+			want:       "CREATE pkg:npm/sigstore@1.0.0",
+		},
+		{
+			name:       "wildcard in pattern",
+			rule:       "ALLOW dist/{name}",
+			parameters: map[string]string{"name": "*"},
+			want:       `ALLOW dist/\*`,
+		},
+		{
+			name:       "step name",
+			rule:       "MATCH * WITH products FROM {step}",
+			parameters: map[string]string{"step": "build"},
+			want:       "MATCH * WITH products FROM build",
+		},
+		{
+			name:       "whitespace",
+			rule:       "CREATE {name}",
+			parameters: map[string]string{"name": "a WITH products FROM evil"},
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := substituteArtifactRuleParameters(test.rule, test.parameters)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveParameters(t *testing.T) {
+	resolved, err := resolveParameters(map[string]string{"a": "{b}-x", "b": "{c}", "c": "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved["a"] != "y-x" {
+		t.Errorf("got %q, want %q", resolved["a"], "y-x")
+	}
+
+	if _, err := resolveParameters(map[string]string{"a": "{b}", "b": "{a}"}); err == nil {
+		t.Error("expected an error for parameters referring to each other")
+	}
+
+	if _, err := resolveParameters(map[string]string{"a b": "x"}); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestParameterNames(t *testing.T) {
+	layout := &Layout{
+		Steps: []*Step{{
+			Name:              "build",
+			ExpectedMaterials: []string{"ALLOW {repo}@{ref}"},
+			ExpectedPredicates: []ExpectedStepPredicates{{
+				ExpectedAttributes: []Constraint{{Rule: "predicate.ref == '{ref}'"}},
+			}},
+		}},
+	}
+
+	got := ParameterNames(layout)
+	if len(got) != 2 || got[0] != "ref" || got[1] != "repo" {
+		t.Errorf("got %v, want [ref repo]", got)
+	}
+}
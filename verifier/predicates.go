@@ -0,0 +1,483 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"github.com/google/cel-go/interpreter"
+	linkPredicatev0 "github.com/in-toto/attestation/go/predicates/link/v0"
+	provenancePredicatev1 "github.com/in-toto/attestation/go/predicates/provenance/v1"
+	releasePredicatev0 "github.com/in-toto/attestation/go/predicates/release/v0"
+	scaiPredicatev0 "github.com/in-toto/attestation/go/predicates/scai/v0"
+	testResultPredicatev0 "github.com/in-toto/attestation/go/predicates/test_result/v0"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	provenancePredicatev02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// PredicateHandler extracts what the verifier needs from statements of a
+// predicate type.
+type PredicateHandler interface {
+	// MaterialsAndProducts returns the artifacts consumed and produced by
+	// the step the statement attests to.
+	MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error)
+}
+
+// TypedPredicateHandler is implemented by handlers that expose the predicate
+// to attribute rules as typed CEL values, in addition to the untyped
+// `predicate` variable.
+type TypedPredicateHandler interface {
+	PredicateHandler
+
+	// CELOptions declares the types and variables provided by the handler.
+	CELOptions() []cel.EnvOption
+
+	// CELInput returns the values of the declared variables for statement.
+	CELInput(statement *attestationv1.Statement) (map[string]any, error)
+}
+
+// PredicateRegistry maps predicate types to their handlers. Statements of
+// unregistered predicate types are handled by treating their subject as
+// materials.
+type PredicateRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]PredicateHandler
+
+	// registered records the predicate types registered with Register, as
+	// opposed to those with a built-in handler.
+	registered map[string]bool
+}
+
+// NewPredicateRegistry returns a registry with handlers for the predicate
+// types known to the verifier.
+func NewPredicateRegistry() *PredicateRegistry {
+	return &PredicateRegistry{handlers: builtinPredicateHandlers(), registered: map[string]bool{}}
+}
+
+// Register sets the handler for predicateType. A built-in handler can be
+// replaced, but a predicate type can only be registered once.
+func (r *PredicateRegistry) Register(predicateType string, handler PredicateHandler) error {
+	if handler == nil {
+		return fmt.Errorf("no handler for predicate type %s", predicateType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.registered[predicateType] {
+		return fmt.Errorf("a handler for predicate type %s is already registered", predicateType)
+	}
+	r.handlers[predicateType] = handler
+	r.registered[predicateType] = true
+
+	return nil
+}
+
+// Handler returns the handler for predicateType.
+func (r *PredicateRegistry) Handler(predicateType string) PredicateHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if handler, ok := r.handlers[predicateType]; ok {
+		return handler
+	}
+
+	return &builtinHandler{}
+}
+
+// clone returns a copy of the registry that can be changed independently.
+func (r *PredicateRegistry) clone() *PredicateRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	registry := &PredicateRegistry{handlers: map[string]PredicateHandler{}, registered: map[string]bool{}}
+	for predicateType, handler := range r.handlers {
+		registry.handlers[predicateType] = handler
+	}
+	for predicateType := range r.registered {
+		registry.registered[predicateType] = true
+	}
+
+	return registry
+}
+
+var defaultPredicateRegistry = NewPredicateRegistry()
+
+// RegisterPredicateHandler registers a handler in the registry used by Verify
+// unless another registry is passed with WithPredicateRegistry.
+func RegisterPredicateHandler(predicateType string, handler PredicateHandler) error {
+	return defaultPredicateRegistry.Register(predicateType, handler)
+}
+
+// builtinHandler implements TypedPredicateHandler for the predicate types
+// known to the verifier.
+type builtinHandler struct {
+	// artifacts extracts materials and products. If nil, the statement's
+	// subject is treated as materials.
+	artifacts func(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error)
+
+	// typedArtifacts extracts materials and products from the typed
+	// predicate, so that the predicate is decoded once for both artifact and
+	// attribute rules. It takes precedence over artifacts.
+	typedArtifacts func(typed any, statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor)
+
+	// variable is the CEL variable the typed predicate is bound to. typed
+	// returns a value to decode the predicate into, either a proto message
+	// or a pointer to a struct with `cel` field tags.
+	variable string
+	typed    func() any
+
+	// functions declares CEL functions over the typed variable.
+	functions func() []cel.EnvOption
+}
+
+func (h *builtinHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	if h.typedArtifacts != nil {
+		input, err := h.CELInput(statement)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		materials, products := h.typedArtifacts(input[h.variable], statement)
+		return materials, products, nil
+	}
+
+	if h.artifacts == nil {
+		return statement.Subject, nil, nil
+	}
+
+	return h.artifacts(statement)
+}
+
+func (h *builtinHandler) CELOptions() []cel.EnvOption {
+	if h.variable == "" {
+		return nil
+	}
+
+	var options []cel.EnvOption
+	switch typed := h.typed().(type) {
+	case proto.Message:
+		options = []cel.EnvOption{
+			cel.Types(typed),
+			cel.Variable(h.variable, cel.ObjectType(string(typed.ProtoReflect().Descriptor().FullName()))),
+		}
+	default:
+		typedType := reflect.TypeOf(typed).Elem()
+		options = []cel.EnvOption{
+			ext.NativeTypes(typedType, ext.ParseStructTags(true)),
+			cel.Variable(h.variable, cel.ObjectType(path.Base(typedType.PkgPath())+"."+typedType.Name())),
+		}
+	}
+
+	if h.functions != nil {
+		options = append(options, h.functions()...)
+	}
+
+	return options
+}
+
+func (h *builtinHandler) CELInput(statement *attestationv1.Statement) (map[string]any, error) {
+	if h.variable == "" {
+		return nil, nil
+	}
+
+	typed := h.typed()
+	if err := decodePredicate(statement, typed); err != nil {
+		return nil, err
+	}
+
+	if _, ok := typed.(proto.Message); ok {
+		return map[string]any{h.variable: typed}, nil
+	}
+
+	return map[string]any{h.variable: reflect.ValueOf(typed).Elem().Interface()}, nil
+}
+
+// decodePredicate decodes the statement's predicate into a proto message or a
+// JSON-tagged struct. Unknown fields are ignored.
+func decodePredicate(statement *attestationv1.Statement, predicate any) error {
+	predicateBytes, err := json.Marshal(statement.Predicate)
+	if err != nil {
+		return err
+	}
+
+	if message, ok := predicate.(proto.Message); ok {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(predicateBytes, message)
+	}
+
+	return json.Unmarshal(predicateBytes, predicate)
+}
+
+func builtinPredicateHandlers() map[string]PredicateHandler {
+	handlers := map[string]PredicateHandler{
+		linkPredicateType: &builtinHandler{
+			typedArtifacts: func(typed any, statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor) {
+				return typed.(*linkPredicatev0.Link).Materials, statement.Subject
+			},
+			variable: "link",
+			typed:    func() any { return &linkPredicatev0.Link{} },
+		},
+		"https://slsa.dev/provenance/v1": &builtinHandler{
+			typedArtifacts: func(typed any, statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor) {
+				return typed.(*provenancePredicatev1.Provenance).GetBuildDefinition().GetResolvedDependencies(), statement.Subject
+			},
+			variable: "provenance",
+			typed:    func() any { return &provenancePredicatev1.Provenance{} },
+		},
+		"https://slsa.dev/provenance/v0.2": &builtinHandler{
+			artifacts: func(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+				// TODO: assumes provenance v0.2 is in statement v1
+				provenance := &provenancePredicatev02.ProvenancePredicate{}
+				if err := decodePredicate(statement, provenance); err != nil {
+					return nil, nil, err
+				}
+
+				materials := []*attestationv1.ResourceDescriptor{}
+				for _, material := range provenance.Materials {
+					materials = append(materials, &attestationv1.ResourceDescriptor{
+						Name:   material.URI, // TODO: figure this out
+						Uri:    material.URI,
+						Digest: material.Digest,
+					})
+				}
+
+				return materials, statement.Subject, nil
+			},
+		},
+		"https://in-toto.io/attestation/test-result/v0.1": &builtinHandler{
+			variable: "testResult",
+			typed:    func() any { return &testResultPredicatev0.TestResult{} },
+		},
+		"https://in-toto.io/attestation/scai/attribute-report/v0.2": &builtinHandler{
+			variable: "scai",
+			typed:    func() any { return &scaiPredicatev0.AttributeReport{} },
+		},
+		"https://in-toto.io/attestation/release/v0.1": &builtinHandler{
+			variable: "release",
+			typed:    func() any { return &releasePredicatev0.Release{} },
+		},
+		"https://in-toto.io/attestation/runtime-trace/v0.1": &builtinHandler{
+			variable: "runtimeTrace",
+			typed:    func() any { return &RuntimeTrace{} },
+		},
+		vulnsPredicateType: &vulnsHandler{},
+		vsaPredicateType: &builtinHandler{
+			// the summarized supply chain produced the subject
+			artifacts: func(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+				return nil, statement.Subject, nil
+			},
+			variable: "vsa",
+			typed:    func() any { return &VerificationSummary{} },
+		},
+	}
+
+	for _, predicateType := range spdxPredicateTypes {
+		handlers[predicateType] = &builtinHandler{
+			variable: "spdx",
+			typed:    func() any { return &SPDXDocument{} },
+			functions: func() []cel.EnvOption {
+				return sbomFunctions("verifier.SPDXDocument", func(value ref.Val) []sbomComponent {
+					return value.Value().(SPDXDocument).components()
+				})
+			},
+		}
+	}
+
+	for _, predicateType := range cycloneDXPredicateTypes {
+		handlers[predicateType] = &builtinHandler{
+			variable: "cyclonedx",
+			typed:    func() any { return &CycloneDXBOM{} },
+			functions: func() []cel.EnvOption {
+				return sbomFunctions("verifier.CycloneDXBOM", func(value ref.Val) []sbomComponent {
+					return value.Value().(CycloneDXBOM).components()
+				})
+			},
+		}
+	}
+
+	return handlers
+}
+
+// RuntimeTrace is the in-toto runtime trace predicate. Log entries are
+// monitor specific and left untyped.
+type RuntimeTrace struct {
+	Monitor          RuntimeTraceMonitor          `json:"monitor" cel:"monitor"`
+	MonitoredProcess RuntimeTraceMonitoredProcess `json:"monitoredProcess" cel:"monitoredProcess"`
+	MonitorLog       RuntimeTraceMonitorLog       `json:"monitorLog" cel:"monitorLog"`
+	Metadata         RuntimeTraceMetadata         `json:"metadata" cel:"metadata"`
+}
+
+type RuntimeTraceMonitor struct {
+	Type string `json:"type" cel:"type"`
+}
+
+type RuntimeTraceMonitoredProcess struct {
+	HostID string `json:"hostID" cel:"hostID"`
+	Type   string `json:"type" cel:"type"`
+	Event  string `json:"event" cel:"event"`
+}
+
+type RuntimeTraceMonitorLog struct {
+	Process    []*structpb.Struct `json:"process" cel:"process"`
+	Network    []*structpb.Struct `json:"network" cel:"network"`
+	FileAccess []*structpb.Struct `json:"fileAccess" cel:"fileAccess"`
+}
+
+type RuntimeTraceMetadata struct {
+	BuildStartedOn  time.Time `json:"buildStartedOn" cel:"buildStartedOn"`
+	BuildFinishedOn time.Time `json:"buildFinishedOn" cel:"buildFinishedOn"`
+}
+
+// expressionHandler computes materials and products with CEL expressions
+// defined in the layout. Lists without an expression are taken from the
+// handler registered for the predicate type.
+type expressionHandler struct {
+	fallback  PredicateHandler
+	materials cel.Program
+	products  cel.Program
+	logger    log.FieldLogger
+
+	// ctx is the context of the verification the handler was created for,
+	// and statements its statement cache
+	ctx        context.Context
+	statements *statementCache
+}
+
+func (h *expressionHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	materials, products, err := h.fallback.MaterialsAndProducts(statement)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input, err := h.statements.activation(statement, h.fallback, h.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if h.materials != nil {
+		materials, err = evalResourceDescriptors(h.ctx, h.materials, input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to compute materials: %w", err)
+		}
+	}
+
+	if h.products != nil {
+		products, err = evalResourceDescriptors(h.ctx, h.products, input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to compute products: %w", err)
+		}
+	}
+
+	return materials, products, nil
+}
+
+// evalResourceDescriptors evaluates a program that returns a list of resource
+// descriptors, given either as in_toto_attestation.v1.ResourceDescriptor
+// messages or as maps with the same fields.
+func evalResourceDescriptors(ctx context.Context, program cel.Program, input interpreter.Activation) ([]*attestationv1.ResourceDescriptor, error) {
+	result, _, err := program.ContextEval(ctx, input)
+	if err != nil {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+
+	list, err := result.ConvertToNative(reflect.TypeOf(&structpb.ListValue{}))
+	if err != nil {
+		return nil, fmt.Errorf("expression must return a list of resource descriptors: %w", err)
+	}
+
+	descriptors := []*attestationv1.ResourceDescriptor{}
+	for _, value := range list.(*structpb.ListValue).GetValues() {
+		valueBytes, err := protojson.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		descriptor := &attestationv1.ResourceDescriptor{}
+		if err := protojson.Unmarshal(valueBytes, descriptor); err != nil {
+			return nil, fmt.Errorf("invalid resource descriptor %s: %w", string(valueBytes), err)
+		}
+
+		descriptors = append(descriptors, descriptor)
+	}
+
+	return descriptors, nil
+}
+
+// artifactHandlers resolves the handler providing the materials and products
+// of a step's claims, preferring expressions defined in the layout over the
+// registry.
+type artifactHandlers struct {
+	registry *PredicateRegistry
+	steps    map[string]map[string]PredicateHandler
+
+	destinations destinationCache
+	statements   statementCache
+}
+
+func (a *artifactHandlers) handler(stepName, predicateType string) PredicateHandler {
+	if handler, ok := a.steps[stepName][predicateType]; ok {
+		return handler
+	}
+
+	return a.registry.Handler(predicateType)
+}
+
+// materialsAndProducts returns the artifacts of a claim for the step.
+func (a *artifactHandlers) materialsAndProducts(stepName string, statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	return a.statements.materialsAndProducts(a.handler(stepName, statement.PredicateType), statement)
+}
+
+// getArtifactHandlers compiles the materials and products expressions of the
+// layout's expected predicates.
+func getArtifactHandlers(ctx context.Context, layout *Layout, getPrograms func(string) (*programCache, error), registry *PredicateRegistry, logger log.FieldLogger) (*artifactHandlers, error) {
+	handlers := &artifactHandlers{registry: registry, steps: map[string]map[string]PredicateHandler{}}
+
+	for _, step := range layout.Steps {
+		for _, expectedPredicate := range step.ExpectedPredicates {
+			if expectedPredicate.MaterialsExpression == "" && expectedPredicate.ProductsExpression == "" {
+				continue
+			}
+
+			handler := &expressionHandler{fallback: registry.Handler(expectedPredicate.PredicateType), logger: logger, ctx: ctx, statements: &handlers.statements}
+			programs, err := getPrograms(expectedPredicate.PredicateType)
+			if err != nil {
+				return nil, err
+			}
+
+			if expectedPredicate.MaterialsExpression != "" {
+				handler.materials, err = programs.program(expectedPredicate.MaterialsExpression)
+				if err != nil {
+					return nil, fmt.Errorf("invalid materials expression for step %s: %w", step.Name, err)
+				}
+			}
+
+			if expectedPredicate.ProductsExpression != "" {
+				handler.products, err = programs.program(expectedPredicate.ProductsExpression)
+				if err != nil {
+					return nil, fmt.Errorf("invalid products expression for step %s: %w", step.Name, err)
+				}
+			}
+
+			if handlers.steps[step.Name] == nil {
+				handlers.steps[step.Name] = map[string]PredicateHandler{}
+			}
+			handlers.steps[step.Name][expectedPredicate.PredicateType] = handler
+		}
+	}
+
+	return handlers, nil
+}
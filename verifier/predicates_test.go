@@ -0,0 +1,304 @@
+package verifier
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestVSAProducts(t *testing.T) {
+	statement := &attestationv1.Statement{
+		Subject: []*attestationv1.ResourceDescriptor{
+			{Name: "libfoo.tar.gz", Digest: map[string]string{"sha256": "aa"}},
+		},
+		PredicateType: vsaPredicateType,
+	}
+
+	handlers := &artifactHandlers{registry: NewPredicateRegistry()}
+	claims := map[string]map[AttestationIdentifier]*attestationv1.Statement{
+		"libfoo": {{PredicateType: vsaPredicateType, Functionary: "verifier"}: statement},
+	}
+
+	materials := map[string]*attestationv1.ResourceDescriptor{
+		"libfoo.tar.gz": {Name: "libfoo.tar.gz", Digest: map[string]string{"sha256": "aa"}},
+	}
+
+	consumed, err := applyMatchRule(map[string]string{
+		"type":    "match",
+		"pattern": "*",
+		"dstType": "products",
+		"dstName": "libfoo",
+	}, materials, newArtifactIndex([]string{"libfoo.tar.gz"}), artifactRuleOptions{handlers: handlers}, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consumed) != 1 {
+		t.Errorf("consumed %v, want the summary's subject matched as products", consumed)
+	}
+}
+
+// buildOutputs is the predicate of the in-house predicate type handled by
+// buildOutputsHandler.
+type buildOutputs struct {
+	Outputs []string `json:"outputs" cel:"outputs"`
+}
+
+// buildOutputsHandler treats a predicate's outputs as products, digested by
+// their own name.
+type buildOutputsHandler struct{}
+
+func (h *buildOutputsHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	predicate := &buildOutputs{}
+	if err := decodePredicate(statement, predicate); err != nil {
+		return nil, nil, err
+	}
+
+	products := []*attestationv1.ResourceDescriptor{}
+	for _, output := range predicate.Outputs {
+		products = append(products, &attestationv1.ResourceDescriptor{Name: output, Digest: map[string]string{"sha256": output}})
+	}
+
+	return statement.Subject, products, nil
+}
+
+func (h *buildOutputsHandler) CELOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		ext.NativeTypes(reflect.TypeOf(buildOutputs{}), ext.ParseStructTags(true)),
+		cel.Variable("build", cel.ObjectType("verifier.buildOutputs")),
+	}
+}
+
+func (h *buildOutputsHandler) CELInput(statement *attestationv1.Statement) (map[string]any, error) {
+	predicate := &buildOutputs{}
+	if err := decodePredicate(statement, predicate); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"build": *predicate}, nil
+}
+
+const buildOutputsPredicateType = "https://example.com/build-outputs/v1"
+
+func TestPredicateRegistryRegister(t *testing.T) {
+	registry := NewPredicateRegistry()
+
+	if _, ok := registry.Handler(buildOutputsPredicateType).(*builtinHandler); !ok {
+		t.Fatalf("unregistered predicate type handled by %T", registry.Handler(buildOutputsPredicateType))
+	}
+
+	handler := &buildOutputsHandler{}
+	if err := registry.Register(buildOutputsPredicateType, handler); err != nil {
+		t.Fatal(err)
+	}
+	if registry.Handler(buildOutputsPredicateType) != handler {
+		t.Errorf("handler %T, want the registered handler", registry.Handler(buildOutputsPredicateType))
+	}
+	if err := registry.Register(buildOutputsPredicateType, &buildOutputsHandler{}); err == nil {
+		t.Error("second handler for the predicate type registered")
+	}
+	if registry.Handler(buildOutputsPredicateType) != handler {
+		t.Error("rejected handler replaced the registered one")
+	}
+
+	// A built-in handler can be replaced once
+	if err := registry.Register(linkPredicateType, handler); err != nil {
+		t.Errorf("built-in handler not replaced: %s", err)
+	}
+	if err := registry.Register(linkPredicateType, handler); err == nil {
+		t.Error("replaced built-in handler replaced again")
+	}
+
+	if err := registry.Register("https://example.com/other/v1", nil); err == nil {
+		t.Error("nil handler registered")
+	}
+
+	// Registrations carry over to clones, but not back
+	clone := registry.clone()
+	if err := clone.Register(buildOutputsPredicateType, handler); err == nil {
+		t.Error("handler registered again in a clone")
+	}
+	if err := clone.Register("https://example.com/other/v1", handler); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.Handler("https://example.com/other/v1").(*builtinHandler); !ok {
+		t.Error("handler registered in a clone registered in the original")
+	}
+	if _, ok := NewPredicateRegistry().Handler(linkPredicateType).(*builtinHandler); !ok {
+		t.Error("replaced built-in handler shared with a new registry")
+	}
+}
+
+func TestTypedPredicateVariables(t *testing.T) {
+	registry := NewPredicateRegistry()
+	if err := registry.Register(buildOutputsPredicateType, &buildOutputsHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(readTestLayout(t, "layout.yml"), WithPredicateRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		predicateType string
+		expression    string
+		err           bool
+	}{
+		{"https://in-toto.io/attestation/test-result/v0.1", "testResult.result == 'PASSED'", false},
+		{"https://in-toto.io/attestation/test-result/v0.1", "size(testResult.failed_tests) == 0", false},
+		{"https://in-toto.io/attestation/test-result/v0.1", "testResult.failedTests.size() == 0", true},
+		{"https://in-toto.io/attestation/test-result/v0.1", "testResult.result == 1", true},
+		{"https://slsa.dev/provenance/v1", "provenance.build_definition.build_type != ''", false},
+		{"https://slsa.dev/provenance/v1", "provenance.build_definition.builder.id != ''", true},
+		{"https://cyclonedx.org/bom", "cyclonedx.no_such_field == ''", true},
+		{buildOutputsPredicateType, "size(build.outputs) > 0", false},
+		{buildOutputsPredicateType, "build.output == ''", true},
+		{buildOutputsPredicateType, "testResult.result == 'PASSED'", true},
+		{"https://example.com/untyped/v1", "predicate.anything == 'PASSED'", false},
+	}
+
+	for _, test := range tests {
+		programs, err := v.getPrograms(test.predicateType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := programs.program(test.expression); (err != nil) != test.err {
+			t.Errorf("compiling %s for %s: error %v, want error %t", test.expression, test.predicateType, err, test.err)
+		}
+	}
+}
+
+func TestArtifactsExpressions(t *testing.T) {
+	predicate, err := structpb.NewStruct(map[string]any{
+		"inputs": []any{map[string]any{"file": "src.tar.gz", "sha256": "aa"}},
+		"output": map[string]any{"file": "app", "sha256": "bb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := &attestationv1.Statement{
+		Subject:       []*attestationv1.ResourceDescriptor{{Name: "subject", Digest: map[string]string{"sha256": "cc"}}},
+		PredicateType: "https://example.com/build/v1",
+		Predicate:     predicate,
+	}
+
+	tests := []struct {
+		name                string
+		materialsExpression string
+		productsExpression  string
+		materials, products []string
+		err                 string
+	}{
+		{
+			name:                "maps",
+			materialsExpression: `predicate.inputs.map(i, {"name": i.file, "digest": {"sha256": i.sha256}})`,
+			productsExpression:  `[{"name": predicate.output.file, "digest": {"sha256": predicate.output.sha256}}]`,
+			materials:           []string{"src.tar.gz"},
+			products:            []string{"app"},
+		},
+		{
+			name:               "resource descriptor messages",
+			productsExpression: `[in_toto_attestation.v1.ResourceDescriptor{name: predicate.output.file, digest: {"sha256": predicate.output.sha256}}]`,
+			materials:          []string{"subject"},
+			products:           []string{"app"},
+		},
+		{
+			name:                "materials only",
+			materialsExpression: `[]`,
+			materials:           []string{},
+			products:            []string{},
+		},
+		{
+			name:               "not a list",
+			productsExpression: `predicate.output.file`,
+			err:                "must return a list of resource descriptors",
+		},
+		{
+			name:               "not resource descriptors",
+			productsExpression: `[predicate.output.file]`,
+			err:                "unable to compute products",
+		},
+		{
+			name:                "missing field",
+			materialsExpression: `[{"name": predicate.missing}]`,
+			err:                 "unable to compute materials",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout := readTestLayout(t, "layout.yml")
+			layout.Steps[0].ExpectedPredicates = []ExpectedStepPredicates{{
+				PredicateType:       statement.PredicateType,
+				MaterialsExpression: test.materialsExpression,
+				ProductsExpression:  test.productsExpression,
+			}}
+
+			v, err := New(layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handlers, err := getArtifactHandlers(context.Background(), layout, v.getPrograms, v.options.registry, v.options.logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			materials, products, err := handlers.materialsAndProducts(layout.Steps[0].Name, statement)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := func(descriptors []*attestationv1.ResourceDescriptor) []string {
+				names := []string{}
+				for _, descriptor := range descriptors {
+					names = append(names, descriptor.Name)
+				}
+				return names
+			}
+			if got := names(materials); !reflect.DeepEqual(got, test.materials) {
+				t.Errorf("materials %v, want %v", got, test.materials)
+			}
+			if got := names(products); !reflect.DeepEqual(got, test.products) {
+				t.Errorf("products %v, want %v", got, test.products)
+			}
+
+			// Other steps keep the registry's handler
+			otherMaterials, _, err := handlers.materialsAndProducts(layout.Steps[1].Name, statement)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(otherMaterials); !reflect.DeepEqual(got, []string{"subject"}) {
+				t.Errorf("materials for another step %v, want the subject", got)
+			}
+		})
+	}
+}
+
+func TestArtifactsExpressionsCompile(t *testing.T) {
+	layout := readTestLayout(t, "layout.yml")
+	layout.Steps[0].ExpectedPredicates = []ExpectedStepPredicates{{
+		PredicateType:      "https://example.com/build/v1",
+		ProductsExpression: `[{"name": "app"}] +`,
+	}}
+
+	v, err := New(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getArtifactHandlers(context.Background(), layout, v.getPrograms, v.options.registry, v.options.logger); err == nil || !strings.Contains(err.Error(), "invalid products expression") {
+		t.Errorf("error %v, want the products expression rejected", err)
+	}
+}
@@ -0,0 +1,68 @@
+package verifier
+
+import (
+	"fmt"
+	"time"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+)
+
+// Result describes a successful verification.
+type Result struct {
+	// VerifiedAt is the time the layout was verified at.
+	VerifiedAt time.Time `json:"verifiedAt"`
+
+	// Attestations holds the digests of the attestations whose claims were
+	// considered, by attestation name.
+	Attestations map[string]map[string]string `json:"attestations"`
+
+	// Products are the products of the accepted claims for the layout's
+	// final step.
+	Products []*attestationv1.ResourceDescriptor `json:"products"`
+
+	// Unused lists the attestations and links for steps the layout does not
+	// use. In lazy mode their signatures and payloads are not checked.
+	Unused []string `json:"unused,omitempty"`
+
+	// SkippedRules lists the attribute rules with allowIfNoClaim that were
+	// not applied to accepted claims, because the claims do not record a
+	// field the rules use.
+	SkippedRules []SkippedRule `json:"skippedRules,omitempty"`
+}
+
+// SkippedRule is an attribute rule that was not applied to a claim.
+type SkippedRule struct {
+	Step        string `json:"step"`
+	Functionary string `json:"functionary"`
+	Rule        string `json:"rule"`
+
+	// Missing is the field or variable the claim does not record, as
+	// written in the rule.
+	Missing string `json:"missing"`
+}
+
+// addProducts records products, keeping the first descriptor for each name.
+// Claims must agree on the digest of each product they record.
+func (r *Result) addProducts(products []*attestationv1.ResourceDescriptor, policy *DigestPolicy) error {
+	for _, product := range products {
+		name := normalizeArtifactName(product.Name)
+		seen := false
+		for _, existing := range r.Products {
+			if normalizeArtifactName(existing.Name) != name {
+				continue
+			}
+
+			if !digestsMatch(existing.Digest, product.Digest, policy) {
+				return fmt.Errorf("claims disagree on the digest of product %s", product.Name)
+			}
+			seen = true
+			break
+		}
+
+		if !seen {
+			r.Products = append(r.Products, product)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package verifier
+
+import (
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+)
+
+func TestResultAddProducts(t *testing.T) {
+	product := func(name string, digest map[string]string) *attestationv1.ResourceDescriptor {
+		return &attestationv1.ResourceDescriptor{Name: name, Digest: digest}
+	}
+
+	result := &Result{}
+	if err := result.addProducts([]*attestationv1.ResourceDescriptor{product("foo", map[string]string{"sha256": "aa"})}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another claim recording the same digest, with more algorithms
+	if err := result.addProducts([]*attestationv1.ResourceDescriptor{
+		product("./foo", map[string]string{"sha256": "aa", "sha512": "bb"}),
+		product("bar", map[string]string{"sha256": "cc"}),
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Products) != 2 || result.Products[0].Name != "foo" || result.Products[1].Name != "bar" {
+		t.Errorf("products %v, want foo and bar", result.Products)
+	}
+
+	if err := result.addProducts([]*attestationv1.ResourceDescriptor{product("foo", map[string]string{"sha256": "dd"})}, nil); err == nil {
+		t.Error("claims disagreeing on the digest of foo accepted")
+	}
+	if err := result.addProducts([]*attestationv1.ResourceDescriptor{product("bar", map[string]string{"sha512": "cc"})}, nil); err == nil {
+		t.Error("claims recording bar with no algorithm in common accepted")
+	}
+}
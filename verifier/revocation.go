@@ -0,0 +1,192 @@
+package verifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// RevocationListPayloadType is the DSSE payload type expected for signed
+// revocation lists. Binding the type prevents an attestation signed by a
+// revocation functionary from being passed off as a revocation list.
+const RevocationListPayloadType = "application/vnd.in-toto.revocations+yaml"
+
+// RevokedKey revokes every signature made by a key. Effective is rejected,
+// see RevocationList.validate.
+type RevokedKey struct {
+	KeyID     string `yaml:"keyID"`
+	Effective string `yaml:"effective,omitempty"`
+	Reason    string `yaml:"reason"`
+}
+
+type RevokedAttestation struct {
+	Digest map[string]string `yaml:"digest"`
+	Reason string            `yaml:"reason"`
+}
+
+type RevocationList struct {
+	Keys         []RevokedKey         `yaml:"keys"`
+	Attestations []RevokedAttestation `yaml:"attestations"`
+
+	// envelope is set when the list was loaded from a DSSE envelope, its
+	// signatures are checked against the layout's revocation policy.
+	envelope *dsse.Envelope
+}
+
+// LoadRevocationList reads a revocation list from path. The file may either
+// contain the list directly (YAML or JSON) or a DSSE envelope whose payload is
+// the list.
+func LoadRevocationList(path string) (*RevocationList, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := &RevocationList{}
+
+	envelope := &dsse.Envelope{}
+	if err := json.Unmarshal(contents, envelope); err == nil && envelope.Payload != "" {
+		if envelope.PayloadType != RevocationListPayloadType {
+			return nil, fmt.Errorf("unexpected payload type for revocation list: %s", envelope.PayloadType)
+		}
+
+		contents, err = envelope.DecodeB64Payload()
+		if err != nil {
+			return nil, err
+		}
+		revocations.envelope = envelope
+	}
+
+	if err := yaml.Unmarshal(contents, revocations); err != nil {
+		return nil, err
+	}
+
+	if err := revocations.validate(); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+// validate rejects effective dates on revoked keys. A date can only be
+// honored against the time a signature was made, which the verifier has no
+// trusted source for, so every signature by a listed key is revoked.
+func (r *RevocationList) validate() error {
+	for _, key := range r.Keys {
+		if key.Effective != "" {
+			return fmt.Errorf("revoked key %s: effective dates are not supported without a trusted signing time, all signatures by a revoked key are rejected", key.KeyID)
+		}
+	}
+
+	return nil
+}
+
+// verify checks the revocation list against the layout's revocation policy.
+// When the layout does not list revocation functionaries, the list is trusted
+// as is.
+func (r *RevocationList) verify(layout *Layout, keys map[string]functionaryKey, logger log.FieldLogger) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	if layout.Revocations == nil || len(layout.Revocations.Functionaries) == 0 {
+		return nil
+	}
+
+	if r.envelope == nil {
+		return fmt.Errorf("layout requires a signed revocation list")
+	}
+
+	functionaries := map[string]Functionary{}
+	for _, reference := range layout.Revocations.Functionaries {
+		name := resolveFunctionary(layout.Functionaries, keys, reference)
+		functionary, ok := layout.Functionaries[name]
+		if !ok {
+			return fmt.Errorf("unknown revocation functionary %s", reference)
+		}
+		functionaries[name] = functionary
+	}
+
+	verifiers, err := getVerifiers(functionaries, logger)
+	if err != nil {
+		return err
+	}
+
+	threshold := layout.Revocations.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	envVerifier, err := newEnvelopeVerifier(threshold, verifiers)
+	if err != nil {
+		return err
+	}
+
+	if _, err := envVerifier.Verify(context.Background(), r.envelope); err != nil {
+		return fmt.Errorf("unable to verify revocation list: %w", err)
+	}
+
+	return nil
+}
+
+// keyRevoked reports whether signatures by keyID must be rejected.
+func (r *RevocationList) keyRevoked(keyID string) (bool, string) {
+	if r == nil {
+		return false, ""
+	}
+
+	for _, key := range r.Keys {
+		if key.KeyID == keyID {
+			return true, revocationReason(key.Reason)
+		}
+	}
+
+	return false, ""
+}
+
+// attestationRevoked reports whether the attestation with the given payload is
+// listed as revoked. Entries match if any digest algorithm computed here
+// agrees.
+func (r *RevocationList) attestationRevoked(payload []byte) (bool, string) {
+	if r == nil {
+		return false, ""
+	}
+
+	digests := getAttestationDigest(payload)
+	for _, attestation := range r.Attestations {
+		for algorithm, digest := range attestation.Digest {
+			if computed, ok := digests[algorithm]; ok && computed == digest {
+				return true, revocationReason(attestation.Reason)
+			}
+		}
+	}
+
+	return false, ""
+}
+
+func revocationReason(reason string) string {
+	if reason == "" {
+		return "no reason given"
+	}
+	return reason
+}
+
+// getAttestationDigest returns the digest set identifying an attestation,
+// computed over its DSSE payload so it is stable regardless of signatures.
+func getAttestationDigest(payload []byte) map[string]string {
+	sha256Digest := sha256.Sum256(payload)
+	sha512Digest := sha512.Sum512(payload)
+
+	return map[string]string{
+		"sha256": hex.EncodeToString(sha256Digest[:]),
+		"sha512": hex.EncodeToString(sha512Digest[:]),
+	}
+}
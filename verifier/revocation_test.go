@@ -0,0 +1,59 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestAddClaimsRevokedKey(t *testing.T) {
+	statement := &attestationv1.Statement{PredicateType: "https://slsa.dev/provenance/v1"}
+
+	tests := []struct {
+		name    string
+		revoked []RevokedKey
+		added   bool
+	}{
+		{"not revoked", nil, true},
+		{"other key revoked", []RevokedKey{{KeyID: "other"}}, true},
+		{"revoked", []RevokedKey{{KeyID: "key", Reason: "key compromised"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &Verifier{
+				options: &verifyOptions{
+					logger:      log.StandardLogger(),
+					revocations: &RevocationList{Keys: test.revoked},
+				},
+				functionaryKeys: map[string]functionaryKey{"key": {name: "builder"}},
+			}
+
+			stepClaims := map[AttestationIdentifier]*attestationv1.Statement{}
+			if added := v.addClaims(stepClaims, "build.key", []byte("payload"), statement, []string{"key"}); added != test.added {
+				t.Errorf("added %t, want %t", added, test.added)
+			}
+		})
+	}
+}
+
+func TestRevocationEffectiveDate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.yml")
+	contents := "keys:\n  - keyID: key\n    effective: \"2024-01-01T00:00:00Z\"\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadRevocationList(path); err == nil || !strings.Contains(err.Error(), "effective dates are not supported") {
+		t.Errorf("error %v, want effective dates rejected", err)
+	}
+
+	revocations := &RevocationList{Keys: []RevokedKey{{KeyID: "key", Effective: "2024-01-01T00:00:00Z"}}}
+	if _, err := New(readTestLayout(t, "layout.yml"), WithRevocationList(revocations)); err == nil || !strings.Contains(err.Error(), "effective dates are not supported") {
+		t.Errorf("error %v, want effective dates rejected", err)
+	}
+}
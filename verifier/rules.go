@@ -1,143 +1,263 @@
 package verifier
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"path"
 	"reflect"
+	"strconv"
 	"strings"
 
-	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/interpreter"
-	linkPredicatev0 "github.com/in-toto/attestation/go/predicates/link/v0"
-	provenancePredicatev1 "github.com/in-toto/attestation/go/predicates/provenance/v1"
 	attestationv1 "github.com/in-toto/attestation/go/v1"
 	"github.com/in-toto/in-toto-golang/in_toto"
-	provenancePredicatev02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
 	log "github.com/sirupsen/logrus"
-	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-func applyArtifactRules(statement *attestationv1.Statement, materialRules []string, productRules []string, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) error {
-	materialsList, productsList, err := getMaterialsAndProducts(statement)
+// artifactRuleOptions holds the layout and step settings that affect how
+// artifact rules are evaluated.
+type artifactRuleOptions struct {
+	patternMode  string
+	digestPolicy *DigestPolicy
+
+	// matchQuorum is the number of distinct destination functionaries that
+	// must agree on an artifact for MATCH rules. If zero, all destination
+	// claims recording the artifact must agree.
+	matchQuorum int
+
+	// stepName is the step whose claims the rules are applied to. handlers
+	// provide the materials and products of claims of each step.
+	stepName string
+	handlers *artifactHandlers
+
+	logger log.FieldLogger
+}
+
+func applyArtifactRules(statement *attestationv1.Statement, materialRules []string, productRules []string, options artifactRuleOptions, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) error {
+	materialsList, productsList, err := options.handlers.materialsAndProducts(options.stepName, statement)
 	if err != nil {
 		return err
 	}
 
-	materials := map[string]*attestationv1.ResourceDescriptor{}
-	materialsPaths := in_toto.NewSet()
-	for _, artifact := range materialsList {
-		artifact := artifact
-		materials[artifact.Name] = artifact
-		materialsPaths.Add(path.Clean(artifact.Name))
+	materials, materialsNames, err := indexArtifacts(materialsList)
+	if err != nil {
+		return fmt.Errorf("materials: %w", err)
 	}
 
-	products := map[string]*attestationv1.ResourceDescriptor{}
-	productsPaths := in_toto.NewSet()
-	for _, artifact := range productsList {
-		artifact := artifact
-		products[artifact.Name] = artifact
-		productsPaths.Add(path.Clean(artifact.Name))
+	products, productsNames, err := indexArtifacts(productsList)
+	if err != nil {
+		return fmt.Errorf("products: %w", err)
 	}
 
-	created := productsPaths.Difference(materialsPaths)
-	deleted := materialsPaths.Difference(productsPaths)
-	remained := materialsPaths.Intersection(productsPaths)
-	modified := in_toto.NewSet()
-	for name := range remained {
-		if !reflect.DeepEqual(materials[name].Digest, products[name].Digest) {
-			modified.Add(name)
+	// Artifacts are classified once, and the remaining artifacts of each
+	// list are tracked by an index that rules consume from. Artifacts whose
+	// digests cannot be compared under the digest policy are neither
+	// unchanged nor modified, and fail rules that would treat them as
+	// modified.
+	created := map[string]bool{}
+	modified := map[string]bool{}
+	unverifiable := map[string][]string{}
+	for name, product := range products {
+		material, ok := materials[name]
+		if !ok {
+			created[name] = true
+		} else if digestsMatch(material.Digest, product.Digest, options.digestPolicy) {
+			continue
+		} else if shared, ok := unverifiableDigests(material.Digest, product.Digest, options.digestPolicy); ok {
+			unverifiable[name] = shared
+		} else {
+			modified[name] = true
 		}
 	}
 
-	log.Infof("Applying material rules...")
+	deleted := map[string]bool{}
+	for name := range materials {
+		if _, ok := products[name]; !ok {
+			deleted[name] = true
+		}
+	}
+
+	materialsQueue := newArtifactIndex(materialsNames)
+	productsQueue := newArtifactIndex(productsNames)
+
+	options.logger.Infof("Applying material rules...")
 	for _, r := range materialRules {
-		log.Infof("Evaluating rule `%s`...", r)
-		rule, err := in_toto.UnpackRule(strings.Split(r, " "))
+		options.logger.Infof("Evaluating rule `%s`...", r)
+		rule, err := unpackRule(r)
+		if err != nil {
+			return err
+		}
+
+		pattern, err := compileArtifactPattern(options.patternMode, normalizeArtifactName(rule["pattern"]))
+		if err != nil {
+			return err
+		}
+
+		filtered, err := materialsQueue.filter(pattern)
 		if err != nil {
 			return err
 		}
 
-		filtered := materialsPaths.Filter(path.Clean(rule["pattern"]))
-		var consumed in_toto.Set
+		var consumed []string
 		switch rule["type"] {
 		case "match":
-			consumed = applyMatchRule(rule, materials, materialsPaths, claims)
+			consumed, err = applyMatchRule(rule, materials, materialsQueue, options, claims)
+			if err != nil {
+				return fmt.Errorf("materials verification failed: %w", err)
+			}
 		case "allow":
 			consumed = filtered
 		case "delete":
-			consumed = filtered.Intersection(deleted)
+			consumed = intersectArtifacts(filtered, deleted)
 		case "disallow":
 			if len(filtered) > 0 {
-				return fmt.Errorf("materials verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
+				return fmt.Errorf("materials verification failed: %s disallowed by rule %s", filtered, rule)
 			}
 		case "require":
-			if !materialsPaths.Has(rule["pattern"]) {
-				return fmt.Errorf("materials verification failed: %s required but not found", rule["pattern"])
+			if err := checkRequired(len(filtered), rule); err != nil {
+				return fmt.Errorf("materials verification failed: %w", err)
 			}
 		default:
 			return fmt.Errorf("invalid material rule %s", rule["type"])
 		}
-		materialsPaths = materialsPaths.Difference(consumed)
+		materialsQueue.consume(consumed)
 	}
 
 	// I've separated these out on purpose right now
-	log.Infof("Applying product rules...")
+	options.logger.Infof("Applying product rules...")
 	for _, r := range productRules {
-		log.Infof("Evaluating rule `%s`...", r)
-		rule, err := in_toto.UnpackRule(strings.Split(r, " "))
+		options.logger.Infof("Evaluating rule `%s`...", r)
+		rule, err := unpackRule(r)
+		if err != nil {
+			return err
+		}
+
+		pattern, err := compileArtifactPattern(options.patternMode, normalizeArtifactName(rule["pattern"]))
+		if err != nil {
+			return err
+		}
+
+		filtered, err := productsQueue.filter(pattern)
 		if err != nil {
 			return err
 		}
 
-		filtered := productsPaths.Filter(path.Clean(rule["pattern"]))
-		var consumed in_toto.Set
+		var consumed []string
 		switch rule["type"] {
 		case "match":
-			consumed = applyMatchRule(rule, products, productsPaths, claims)
+			consumed, err = applyMatchRule(rule, products, productsQueue, options, claims)
+			if err != nil {
+				return fmt.Errorf("products verification failed: %w", err)
+			}
 		case "allow":
 			consumed = filtered
 		case "create":
-			consumed = filtered.Intersection(created)
+			consumed = intersectArtifacts(filtered, created)
 		case "modify":
-			consumed = filtered.Intersection(modified)
+			for _, name := range filtered {
+				if shared, ok := unverifiable[name]; ok {
+					return fmt.Errorf("products verification failed: modification of %s cannot be verified, its material and product digests %s", name, describeUnverifiable(shared))
+				}
+			}
+			consumed = intersectArtifacts(filtered, modified)
 		case "disallow":
 			if len(filtered) > 0 {
-				return fmt.Errorf("products verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
+				return fmt.Errorf("products verification failed: %s disallowed by rule %s", filtered, rule)
 			}
 		case "require":
-			if !productsPaths.Has(rule["pattern"]) {
-				return fmt.Errorf("products verification failed: %s required but not found", rule["pattern"])
+			if err := checkRequired(len(filtered), rule); err != nil {
+				return fmt.Errorf("products verification failed: %w", err)
 			}
 		default:
 			return fmt.Errorf("invalid product rule %s", rule["type"])
 		}
-		productsPaths = productsPaths.Difference(consumed)
+		productsQueue.consume(consumed)
 	}
 
 	return nil
 }
 
-func applyAttributeRules(env *cel.Env, input interpreter.Activation, rules []Constraint) error {
-	log.Infof("Applying attribute rules...")
-	for _, r := range rules {
-		log.Infof("Evaluating rule `%s`...", r.Rule)
-		ast, issues := env.Compile(r.Rule)
-		if issues != nil && issues.Err() != nil {
-			return issues.Err()
+// intersectArtifacts returns the names that are in set.
+func intersectArtifacts(names []string, set map[string]bool) []string {
+	intersection := []string{}
+	for _, name := range names {
+		if set[name] {
+			intersection = append(intersection, name)
+		}
+	}
+
+	return intersection
+}
+
+// unpackRule parses an artifact rule. In addition to the rules understood by
+// in-toto, REQUIRE accepts a minimum count of matching artifacts:
+//
+//	REQUIRE <pattern> MIN <count>
+func unpackRule(r string) (map[string]string, error) {
+	tokens := strings.Split(r, " ")
+	if len(tokens) == 4 && strings.ToLower(tokens[0]) == "require" && strings.ToLower(tokens[2]) == "min" {
+		if _, err := strconv.Atoi(tokens[3]); err != nil {
+			return nil, fmt.Errorf("invalid minimum count in rule %s", r)
 		}
 
-		prog, err := env.Program(ast)
+		return map[string]string{
+			"type":    "require",
+			"pattern": tokens[1],
+			"min":     tokens[3],
+		}, nil
+	}
+
+	return in_toto.UnpackRule(tokens)
+}
+
+// checkRequired ensures at least the rule's minimum count of artifacts, one by
+// default, was matched by a REQUIRE rule.
+func checkRequired(count int, rule map[string]string) error {
+	minimum := 1
+	if rule["min"] != "" {
+		minimum, _ = strconv.Atoi(rule["min"]) // validated in unpackRule
+	}
+
+	if count < minimum {
+		return fmt.Errorf("%s required at least %d times but found %d times", rule["pattern"], minimum, count)
+	}
+
+	return nil
+}
+
+// applyAttributeRules evaluates the rules against input. Rules that allow it
+// are skipped if they fail because input does not record a field they use,
+// and are returned.
+func applyAttributeRules(ctx context.Context, programs *programCache, input interpreter.Activation, rules []Constraint, logger log.FieldLogger) ([]SkippedRule, error) {
+	logger.Infof("Applying attribute rules...")
+	skipped := []SkippedRule{}
+	for _, r := range rules {
+		logger.Infof("Evaluating rule `%s`...", r.Rule)
+		prog, err := programs.program(r.Rule)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		out, _, err := prog.Eval(input)
+		out, _, err := prog.ContextEval(ctx, input)
 		if err != nil {
-			if strings.Contains(err.Error(), "no such attribute") || strings.Contains(err.Error(), "no such key") && r.AllowIfNoClaim {
-				continue
+			if err := checkContext(ctx); err != nil {
+				return nil, err
 			}
-			return err
+			if r.AllowIfNoClaim {
+				missing, missingErr := programs.missingField(ctx, r.Rule, input)
+				if missingErr != nil {
+					return nil, missingErr
+				}
+				if missing != "" {
+					logger.Infof("Claim does not record %s, skipping rule", missing)
+					skipped = append(skipped, SkippedRule{Rule: r.Rule, Missing: missing})
+					continue
+				}
+			}
+			if explanation := explainRule(ctx, programs, r.Rule, input, logger); explanation != "" {
+				return nil, fmt.Errorf("%w\n%s", err, explanation)
+			}
+			return nil, err
 		}
 		switch result := out.Value().(type) {
 		case bool:
@@ -148,183 +268,364 @@ func applyAttributeRules(env *cel.Env, input interpreter.Activation, rules []Con
 				} else {
 					message = fmt.Sprintf("%s\nin rule '%s'", r.Debug, r.Rule)
 				}
+				if explanation := explainRule(ctx, programs, r.Rule, input, logger); explanation != "" {
+					message = fmt.Sprintf("%s\n%s", message, explanation)
+				}
 
 				if !r.Warn {
-					return fmt.Errorf(message)
+					return nil, fmt.Errorf(message)
 				}
 
-				log.Warnf("%s", message)
+				logger.Warnf("%s", message)
 			}
 		case error:
-			log.Info(result)
-			return fmt.Errorf("CEL error: %w", result)
+			logger.Info(result)
+			return nil, fmt.Errorf("CEL error: %w", result)
 		}
 	}
 
-	return nil
+	return skipped, nil
 }
 
-func getMaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
-	switch statement.PredicateType {
-	case "https://in-toto.io/attestation/link/v0.3":
-		linkBytes, err := json.Marshal(statement.Predicate)
-		if err != nil {
-			return nil, nil, err
-		}
+// explainRule returns the values of the rule's sub-expressions if explain mode
+// is on, and an empty string otherwise.
+func explainRule(ctx context.Context, programs *programCache, rule string, input interpreter.Activation, logger log.FieldLogger) string {
+	if !programs.explainRules {
+		return ""
+	}
+
+	explanation, err := programs.explain(ctx, rule, input)
+	if err != nil {
+		logger.Warnf("Unable to explain rule '%s': %s", rule, err)
+		return ""
+	}
+
+	return explanation
+}
 
-		link := &linkPredicatev0.Link{}
-		if err := protojson.Unmarshal(linkBytes, link); err != nil {
-			return nil, nil, err
+// applyCommandRule compares the step's expected command with the command
+// recorded in the statement. Expected commands are given as arguments or split
+// on whitespace, and compared exactly or as a prefix of the recorded command,
+// or matched as a pattern against the space-joined recorded command.
+// Statements that don't record a command fail the check unless mismatches
+// only warn.
+func applyCommandRule(statement *attestationv1.Statement, step *Step, logger log.FieldLogger) error {
+	expectedFields := step.CommandArgs
+	expectedCommand := strings.Join(step.CommandArgs, " ")
+	if len(expectedFields) == 0 {
+		expectedFields = strings.Fields(step.Command)
+		expectedCommand = step.Command
+	}
+
+	if len(expectedFields) == 0 {
+		return nil
+	}
+
+	logger.Infof("Verifying command...")
+	command, ok := getCommand(statement)
+	if !ok {
+		if !step.CommandWarn {
+			return fmt.Errorf("expected command '%s' but no command is recorded", expectedCommand)
 		}
 
-		return link.Materials, statement.Subject, nil
+		logger.Warnf("No command recorded in claim, expected '%s'", expectedCommand)
+		return nil
+	}
 
-	case "https://slsa.dev/provenance/v1":
-		provenanceBytes, err := json.Marshal(statement.Predicate)
+	var matched bool
+	switch step.CommandMatch {
+	case "", "exact":
+		matched = reflect.DeepEqual(expectedFields, command)
+	case "prefix":
+		matched = len(command) >= len(expectedFields) && reflect.DeepEqual(expectedFields, command[:len(expectedFields)])
+	case "glob":
+		var err error
+		matched, err = match(expectedCommand, strings.Join(command, " "))
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
+	default:
+		return fmt.Errorf("invalid command match mode %s", step.CommandMatch)
+	}
 
-		provenance := &provenancePredicatev1.Provenance{}
-		if err := protojson.Unmarshal(provenanceBytes, provenance); err != nil {
-			return nil, nil, err
-		}
+	if matched {
+		return nil
+	}
+
+	message := fmt.Sprintf("expected command '%s' does not match recorded command '%s'", expectedCommand, strings.Join(command, " "))
+	if !step.CommandWarn {
+		return fmt.Errorf(message)
+	}
 
-		return provenance.BuildDefinition.ResolvedDependencies, statement.Subject, nil
+	logger.Warnf("%s", message)
+	return nil
+}
 
+// getCommand returns the command recorded in the statement. Link predicates
+// always record one, provenance only does where the build type records it as
+// a `command` parameter.
+func getCommand(statement *attestationv1.Statement) ([]string, bool) {
+	var fieldPath []string
+	switch statement.PredicateType {
+	case linkPredicateType:
+		fieldPath = []string{"command"}
+	case "https://slsa.dev/provenance/v1":
+		fieldPath = []string{"buildDefinition", "externalParameters", "command"}
 	case "https://slsa.dev/provenance/v0.2":
-		// TODO: assumes provenance v0.2 is in statement v1
+		fieldPath = []string{"invocation", "parameters", "command"}
+	default:
+		return nil, false
+	}
 
-		provenanceBytes, err := json.Marshal(statement.Predicate)
-		if err != nil {
-			return nil, nil, err
-		}
+	fields := statement.Predicate.GetFields()
+	for _, field := range fieldPath[:len(fieldPath)-1] {
+		fields = fields[field].GetStructValue().GetFields()
+	}
 
-		provenance := &provenancePredicatev02.ProvenancePredicate{}
-		if err := json.Unmarshal(provenanceBytes, provenance); err != nil {
-			return nil, nil, err
-		}
+	value, ok := fields[fieldPath[len(fieldPath)-1]]
+	if !ok || value.GetListValue() == nil {
+		return nil, false
+	}
 
-		materials := []*attestationv1.ResourceDescriptor{}
-		for _, material := range provenance.Materials {
-			materials = append(materials, &attestationv1.ResourceDescriptor{
-				Name:   material.URI, // TODO: figure this out
-				Uri:    material.URI,
-				Digest: material.Digest,
-			})
+	command := []string{}
+	for _, element := range value.GetListValue().GetValues() {
+		argument, ok := element.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, false
 		}
+		command = append(command, argument.StringValue)
+	}
 
-		return materials, statement.Subject, nil
+	return command, true
+}
 
-	default:
-		return statement.Subject, nil, nil
+// applySubjectRule checks that each artifact in the statement's subject
+// matches a product of the step dstName.
+func applySubjectRule(statement *attestationv1.Statement, dstName string, options artifactRuleOptions, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) error {
+	if dstName == "" {
+		return nil
 	}
+
+	if len(statement.Subject) == 0 {
+		return fmt.Errorf("no subject to match against products of step %s", dstName)
+	}
+
+	subject, names, err := indexArtifacts(statement.Subject)
+	if err != nil {
+		return fmt.Errorf("subject: %w", err)
+	}
+	queue := newArtifactIndex(names)
+
+	pattern := "*"
+	if options.patternMode == pathPatternMode {
+		pattern = "**"
+	}
+
+	consumed, err := applyMatchRule(map[string]string{
+		"type":    "match",
+		"pattern": pattern,
+		"dstType": "products",
+		"dstName": dstName,
+	}, subject, queue, options, claims)
+	if err != nil {
+		return err
+	}
+
+	queue.consume(consumed)
+	if unmatched := queue.withPrefix(""); len(unmatched) > 0 {
+		return fmt.Errorf("subject %s does not match products of step %s", strings.Join(unmatched, ", "), dstName)
+	}
+
+	return nil
 }
 
-func applyMatchRule(rule map[string]string, srcArtifacts map[string]*attestationv1.ResourceDescriptor, queue in_toto.Set, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) in_toto.Set {
-	consumed := in_toto.NewSet()
+func applyMatchRule(rule map[string]string, srcArtifacts map[string]*attestationv1.ResourceDescriptor, queue *artifactIndex, options artifactRuleOptions, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) ([]string, error) {
+	consumed := []string{}
 
-	dstClaims, ok := claims[rule["dstName"]]
+	dstName := rule["dstName"]
+	dstClaims, ok := claims[dstName]
 	if !ok {
-		return consumed
+		return consumed, nil
 	}
 
-	dstMaterials, dstProducts, err := getDestinationArtifacts(dstClaims)
+	destination, err := options.handlers.destinations.get(options.handlers, dstName, dstClaims)
 	if err != nil {
-		// FIXME: what is the right behaviour here across claims?
-		return consumed
+		return nil, fmt.Errorf("unable to load artifacts of step %s: %w", dstName, err)
 	}
 
-	var dstArtifacts map[string]*attestationv1.ResourceDescriptor
+	dstArtifacts := destination.products
 	if rule["dstType"] == "materials" {
-		dstArtifacts = dstMaterials
-	} else {
-		dstArtifacts = dstProducts
+		dstArtifacts = destination.materials
 	}
 
-	if rule["pattern"] != "" {
-		rule["pattern"] = path.Clean(rule["pattern"])
+	// Source and destination artifacts are keyed by their normalized names
+	patternString := rule["pattern"]
+	if patternString != "" {
+		patternString = normalizeArtifactName(patternString)
 	}
 
-	for p := range srcArtifacts {
-		if path.Clean(p) != p {
-			srcArtifacts[path.Clean(p)] = srcArtifacts[p]
-			delete(srcArtifacts, p)
-		}
-	}
-
-	for p := range dstArtifacts {
-		if path.Clean(p) != p {
-			dstArtifacts[path.Clean(p)] = dstArtifacts[p]
-			delete(dstArtifacts, p)
-		}
+	pattern, err := compileArtifactPattern(options.patternMode, patternString)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, prefix := range []string{"srcPrefix", "dstPrefix"} {
-		if rule[prefix] != "" {
-			rule[prefix] = path.Clean(rule[prefix])
-			if !strings.HasSuffix(rule[prefix], "/") {
-				rule[prefix] += "/"
+	srcPrefix := normalizePrefix(rule["srcPrefix"])
+	dstPrefix := normalizePrefix(rule["dstPrefix"])
+
+	// The pattern is matched against source paths with the source prefix
+	// removed, so only paths starting with the prefix followed by the
+	// pattern's literal prefix can match. Paths without the source prefix
+	// are matched as they are.
+	candidates := queue.withPrefix(srcPrefix + pattern.prefix)
+	if srcPrefix != "" {
+		for _, srcPath := range queue.withPrefix(pattern.prefix) {
+			if !strings.HasPrefix(srcPath, srcPrefix) {
+				candidates = append(candidates, srcPath)
 			}
 		}
 	}
 
-	for srcPath := range queue {
-		srcBasePath := strings.TrimPrefix(srcPath, rule["srcPrefix"])
+	for _, srcPath := range candidates {
+		srcBasePath := strings.TrimPrefix(srcPath, srcPrefix)
 
 		// Ignore artifacts not matched by rule pattern
-		matched, err := match(rule["pattern"], srcBasePath)
-		if err != nil || !matched {
+		matched, err := pattern.match(srcBasePath)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
 			continue
 		}
 
 		// Construct corresponding destination artifact path, i.e.
-		// an optional destination prefix plus the source base path
-		dstPath := path.Clean(path.Join(rule["dstPrefix"], srcBasePath))
+		// an optional destination prefix plus the source base path. Without
+		// prefixes, it is the already normalized source path.
+		dstPath := srcPath
+		if srcPrefix != "" || dstPrefix != "" {
+			dstPath = normalizeArtifactName(dstPrefix + srcBasePath)
+		}
 
 		// Try to find the corresponding destination artifact
-		dstArtifact, exists := dstArtifacts[dstPath]
+		candidates, exists := dstArtifacts[dstPath]
 		// Ignore artifacts without corresponding destination artifact
 		if !exists {
 			continue
 		}
 
+		// Destination claims must agree on the artifact before it can be
+		// matched against
+		dstArtifact, err := resolveDestinationArtifact(dstPath, candidates, options)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", dstName, err)
+		}
+		if dstArtifact == nil {
+			continue
+		}
+
 		// Ignore artifact pairs with no matching hashes
-		if !reflect.DeepEqual(srcArtifacts[srcPath].Digest, dstArtifact.Digest) {
+		if !digestsMatch(srcArtifacts[srcPath].Digest, dstArtifact.Digest, options.digestPolicy) {
 			continue
 		}
 
 		// Only if a source and destination artifact pair was found and
 		// their hashes are equal, will we mark the source artifact as
 		// successfully consumed, i.e. it will be removed from the queue
-		consumed.Add(srcPath)
+		consumed = append(consumed, srcPath)
 	}
 
-	return consumed
+	return consumed, nil
 }
 
-func getDestinationArtifacts(dstClaims map[AttestationIdentifier]*attestationv1.Statement) (map[string]*attestationv1.ResourceDescriptor, map[string]*attestationv1.ResourceDescriptor, error) {
-	materials := map[string]*attestationv1.ResourceDescriptor{}
-	products := map[string]*attestationv1.ResourceDescriptor{}
+// destinationArtifact is an artifact recorded by a claim of a MATCH rule's
+// destination step, with the functionary that claims it.
+type destinationArtifact struct {
+	functionary string
+	artifact    *attestationv1.ResourceDescriptor
+}
 
-	for _, claim := range dstClaims {
-		materialsList, productsList, err := getMaterialsAndProducts(claim)
+// getDestinationArtifacts collects the materials and products recorded by each
+// of the destination step's claims, keyed by normalized name.
+func getDestinationArtifacts(handlers *artifactHandlers, dstName string, dstClaims map[AttestationIdentifier]*attestationv1.Statement) (map[string][]destinationArtifact, map[string][]destinationArtifact, error) {
+	materials := map[string][]destinationArtifact{}
+	products := map[string][]destinationArtifact{}
+
+	for identifier, claim := range dstClaims {
+		materialsList, productsList, err := handlers.materialsAndProducts(dstName, claim)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, fmt.Errorf("claim by %s: %w", identifier.Functionary, err)
 		}
 
-		// FIXME: we're overwriting artifact info without checking if claims agree
-
-		for _, artifact := range materialsList {
-			artifact := artifact
-			materials[artifact.Name] = artifact
+		claimMaterials, _, err := indexArtifacts(materialsList)
+		if err != nil {
+			return nil, nil, fmt.Errorf("claim by %s: materials: %w", identifier.Functionary, err)
+		}
+		for name, artifact := range claimMaterials {
+			materials[name] = append(materials[name], destinationArtifact{functionary: identifier.Functionary, artifact: artifact})
 		}
 
-		for _, artifact := range productsList {
-			artifact := artifact
-			products[artifact.Name] = artifact
+		claimProducts, _, err := indexArtifacts(productsList)
+		if err != nil {
+			return nil, nil, fmt.Errorf("claim by %s: products: %w", identifier.Functionary, err)
+		}
+		for name, artifact := range claimProducts {
+			products[name] = append(products[name], destinationArtifact{functionary: identifier.Functionary, artifact: artifact})
 		}
 	}
 
 	return materials, products, nil
 }
+
+// resolveDestinationArtifact returns the artifact the destination claims
+// recording it agree on. Without a quorum, all of them must agree. With a
+// quorum, the digest recorded by at least that many distinct functionaries is
+// used, and nil is returned if no digest reaches the quorum while claims agree.
+func resolveDestinationArtifact(name string, candidates []destinationArtifact, options artifactRuleOptions) (*attestationv1.ResourceDescriptor, error) {
+	// group candidates by matching digests, recording the functionaries
+	// claiming each
+	type digestGroup struct {
+		artifact      *attestationv1.ResourceDescriptor
+		functionaries map[string]bool
+	}
+	groups := []*digestGroup{}
+	for _, candidate := range candidates {
+		var group *digestGroup
+		for _, g := range groups {
+			if digestsMatch(g.artifact.Digest, candidate.artifact.Digest, options.digestPolicy) {
+				group = g
+				break
+			}
+		}
+
+		if group == nil {
+			group = &digestGroup{artifact: candidate.artifact, functionaries: map[string]bool{}}
+			groups = append(groups, group)
+		}
+		group.functionaries[candidate.functionary] = true
+	}
+
+	if options.matchQuorum == 0 {
+		if len(groups) > 1 {
+			return nil, fmt.Errorf("claims disagree on the digest of %s", name)
+		}
+
+		return groups[0].artifact, nil
+	}
+
+	var agreed *attestationv1.ResourceDescriptor
+	for _, group := range groups {
+		if len(group.functionaries) < options.matchQuorum {
+			continue
+		}
+
+		if agreed != nil {
+			return nil, fmt.Errorf("claims disagree on the digest of %s with more than one digest reaching the quorum", name)
+		}
+		agreed = group.artifact
+	}
+
+	if agreed == nil && len(groups) > 1 {
+		return nil, fmt.Errorf("claims disagree on the digest of %s with no digest reaching the quorum of %d", name, options.matchQuorum)
+	}
+
+	return agreed, nil
+}
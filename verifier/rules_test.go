@@ -0,0 +1,255 @@
+package verifier
+
+import (
+	"strings"
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestResolveDestinationArtifact(t *testing.T) {
+	artifact := func(functionary, digest string) destinationArtifact {
+		return destinationArtifact{
+			functionary: functionary,
+			artifact:    &attestationv1.ResourceDescriptor{Name: "foo", Digest: map[string]string{"sha256": digest}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		candidates []destinationArtifact
+		quorum     int
+		digest     string
+		err        bool
+	}{
+		{
+			name:       "single claim",
+			candidates: []destinationArtifact{artifact("alice", "aa")},
+			digest:     "aa",
+		},
+		{
+			name:       "claims agree",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("bob", "aa")},
+			digest:     "aa",
+		},
+		{
+			name:       "claims disagree",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("bob", "bb")},
+			err:        true,
+		},
+		{
+			name:       "quorum reached",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("bob", "aa"), artifact("carol", "bb")},
+			quorum:     2,
+			digest:     "aa",
+		},
+		{
+			name:       "quorum not reached while claims agree",
+			candidates: []destinationArtifact{artifact("alice", "aa")},
+			quorum:     2,
+		},
+		{
+			name:       "quorum not reached by one functionary's claims",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("alice", "aa")},
+			quorum:     2,
+		},
+		{
+			name:       "one functionary's claims outvoting another",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("alice", "aa"), artifact("bob", "bb")},
+			quorum:     2,
+			err:        true,
+		},
+		{
+			name:       "several digests reaching the quorum",
+			candidates: []destinationArtifact{artifact("alice", "aa"), artifact("bob", "aa"), artifact("carol", "bb"), artifact("dave", "bb")},
+			quorum:     2,
+			err:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveDestinationArtifact("foo", test.candidates, artifactRuleOptions{matchQuorum: test.quorum})
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %t", err, test.err)
+			}
+
+			digest := ""
+			if resolved != nil {
+				digest = resolved.Digest["sha256"]
+			}
+			if digest != test.digest {
+				t.Errorf("resolved digest %q, want %q", digest, test.digest)
+			}
+		})
+	}
+}
+
+func TestGetAuthorizedClaims(t *testing.T) {
+	layout := &Layout{
+		Functionaries: map[string]Functionary{"alice": {}, "bob": {}, "mallory": {}},
+		Steps: []*Step{{
+			Name: "build",
+			ExpectedPredicates: []ExpectedStepPredicates{{
+				PredicateType: "https://slsa.dev/provenance/v1",
+				Functionaries: []string{"alice", "bob"},
+			}},
+		}},
+	}
+
+	claims := map[string]map[AttestationIdentifier]*attestationv1.Statement{
+		"build": {
+			{PredicateType: "https://slsa.dev/provenance/v1", Functionary: "alice"}:   {},
+			{PredicateType: "https://slsa.dev/provenance/v1", Functionary: "mallory"}: {},
+			{PredicateType: "https://example.com/other/v1", Functionary: "bob"}:       {},
+		},
+		"other": {
+			{PredicateType: "https://slsa.dev/provenance/v1", Functionary: "alice"}: {},
+		},
+	}
+
+	authorized := getAuthorizedClaims(layout, map[string]functionaryKey{}, claims)
+	if len(authorized) != 1 || len(authorized["build"]) != 1 {
+		t.Fatalf("authorized claims %v, want alice's provenance for build", authorized)
+	}
+	if _, ok := authorized["build"][AttestationIdentifier{PredicateType: "https://slsa.dev/provenance/v1", Functionary: "alice"}]; !ok {
+		t.Errorf("authorized claims %v, want alice's provenance for build", authorized)
+	}
+}
+
+func TestApplyCommandRule(t *testing.T) {
+	predicate, err := structpb.NewStruct(map[string]any{
+		"command": []any{"sh", "-c", "make && make install"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := &attestationv1.Statement{PredicateType: linkPredicateType, Predicate: predicate}
+
+	tests := []struct {
+		name string
+		step *Step
+		err  bool
+	}{
+		{"no expected command", &Step{}, false},
+		{"arguments", &Step{CommandArgs: []string{"sh", "-c", "make && make install"}}, false},
+		{"arguments split differently", &Step{CommandArgs: []string{"sh", "-c", "make", "&&", "make", "install"}}, true},
+		{"whitespace-separated command", &Step{Command: "sh -c make && make install"}, true},
+		{"prefix", &Step{Command: "sh -c", CommandMatch: "prefix"}, false},
+		{"glob", &Step{Command: "sh -c make*", CommandMatch: "glob"}, false},
+		{"glob of arguments", &Step{CommandArgs: []string{"sh", "-c", "make*"}, CommandMatch: "glob"}, false},
+		{"mismatch with warning", &Step{Command: "make", CommandWarn: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := applyCommandRule(statement, test.step, log.StandardLogger()); (err != nil) != test.err {
+				t.Errorf("error %v, want error %t", err, test.err)
+			}
+		})
+	}
+}
+
+func TestApplyCommandRuleNoCommand(t *testing.T) {
+	statement := &attestationv1.Statement{PredicateType: "https://slsa.dev/provenance/v1", Predicate: &structpb.Struct{}}
+
+	if err := applyCommandRule(statement, &Step{Command: "make"}, log.StandardLogger()); err == nil {
+		t.Error("claim without a command passed the command check")
+	}
+
+	if err := applyCommandRule(statement, &Step{Command: "make", CommandWarn: true}, log.StandardLogger()); err != nil {
+		t.Errorf("claim without a command failed the command check with warnings: %s", err)
+	}
+}
+
+func TestApplyArtifactRulesUnverifiableDigests(t *testing.T) {
+	linkStatement := func(material, product map[string]string) *attestationv1.Statement {
+		digest := func(digest map[string]string) map[string]any {
+			value := map[string]any{}
+			for algorithm, hex := range digest {
+				value[algorithm] = hex
+			}
+			return value
+		}
+
+		predicate, err := structpb.NewStruct(map[string]any{
+			"name":      "build",
+			"materials": []any{map[string]any{"name": "foo", "digest": digest(material)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &attestationv1.Statement{
+			PredicateType: linkPredicateType,
+			Subject:       []*attestationv1.ResourceDescriptor{{Name: "foo", Digest: product}},
+			Predicate:     predicate,
+		}
+	}
+
+	tests := []struct {
+		name              string
+		material, product map[string]string
+		rules             []string
+		err               string
+	}{
+		{
+			name:     "modified",
+			material: map[string]string{"sha256": "aa"},
+			product:  map[string]string{"sha256": "bb"},
+			rules:    []string{"MODIFY foo", "DISALLOW *"},
+		},
+		{
+			name:     "unchanged",
+			material: map[string]string{"sha256": "aa"},
+			product:  map[string]string{"sha256": "aa"},
+			rules:    []string{"MODIFY foo", "DISALLOW *"},
+			err:      "disallowed",
+		},
+		{
+			name:     "weak algorithm",
+			material: map[string]string{"sha1": "aa"},
+			product:  map[string]string{"sha1": "aa"},
+			rules:    []string{"MODIFY foo", "DISALLOW *"},
+			err:      "only share sha1",
+		},
+		{
+			name:     "weak algorithm disagreeing",
+			material: map[string]string{"sha1": "aa"},
+			product:  map[string]string{"sha1": "bb"},
+			rules:    []string{"MODIFY foo", "DISALLOW *"},
+		},
+		{
+			name:     "no shared algorithm",
+			material: map[string]string{"sha256": "aa"},
+			product:  map[string]string{"sha512": "bb"},
+			rules:    []string{"MODIFY foo", "DISALLOW *"},
+			err:      "share no digest algorithm",
+		},
+		{
+			name:     "allowed",
+			material: map[string]string{"sha1": "aa"},
+			product:  map[string]string{"sha1": "aa"},
+			rules:    []string{"ALLOW foo"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := artifactRuleOptions{
+				stepName: "build",
+				handlers: &artifactHandlers{registry: NewPredicateRegistry()},
+				logger:   log.StandardLogger(),
+			}
+
+			err := applyArtifactRules(linkStatement(test.material, test.product), []string{"ALLOW foo"}, test.rules, options, nil)
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("error %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
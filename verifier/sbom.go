@@ -0,0 +1,585 @@
+package verifier
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var spdxPredicateTypes = []string{
+	"https://spdx.dev/Document",
+	"https://spdx.dev/Document/v2.2",
+	"https://spdx.dev/Document/v2.3",
+}
+
+var cycloneDXPredicateTypes = []string{
+	"https://cyclonedx.org/bom",
+	"https://cyclonedx.org/bom/v1.4",
+	"https://cyclonedx.org/bom/v1.5",
+	"https://cyclonedx.org/bom/v1.6",
+}
+
+// SPDXDocument is the subset of an SPDX 2.x JSON document exposed to
+// attribute rules.
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion" cel:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense" cel:"dataLicense"`
+	SPDXID            string             `json:"SPDXID" cel:"SPDXID"`
+	Name              string             `json:"name" cel:"name"`
+	DocumentNamespace string             `json:"documentNamespace" cel:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo" cel:"creationInfo"`
+	DocumentDescribes []string           `json:"documentDescribes,omitempty" cel:"documentDescribes"`
+	Packages          []SPDXPackage      `json:"packages,omitempty" cel:"packages"`
+	Files             []SPDXFile         `json:"files,omitempty" cel:"files"`
+	Relationships     []SPDXRelationship `json:"relationships,omitempty" cel:"relationships"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created" cel:"created"`
+	Creators []string `json:"creators" cel:"creators"`
+}
+
+type SPDXPackage struct {
+	SPDXID           string            `json:"SPDXID" cel:"SPDXID"`
+	Name             string            `json:"name" cel:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty" cel:"versionInfo"`
+	Supplier         string            `json:"supplier,omitempty" cel:"supplier"`
+	DownloadLocation string            `json:"downloadLocation,omitempty" cel:"downloadLocation"`
+	LicenseConcluded string            `json:"licenseConcluded,omitempty" cel:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared,omitempty" cel:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText,omitempty" cel:"copyrightText"`
+	Checksums        []SPDXChecksum    `json:"checksums,omitempty" cel:"checksums"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs,omitempty" cel:"externalRefs"`
+}
+
+type SPDXFile struct {
+	SPDXID           string         `json:"SPDXID" cel:"SPDXID"`
+	FileName         string         `json:"fileName" cel:"fileName"`
+	LicenseConcluded string         `json:"licenseConcluded,omitempty" cel:"licenseConcluded"`
+	Checksums        []SPDXChecksum `json:"checksums,omitempty" cel:"checksums"`
+}
+
+type SPDXChecksum struct {
+	Algorithm     string `json:"algorithm" cel:"algorithm"`
+	ChecksumValue string `json:"checksumValue" cel:"checksumValue"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory" cel:"referenceCategory"`
+	ReferenceType     string `json:"referenceType" cel:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator" cel:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId" cel:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType" cel:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement" cel:"relatedSpdxElement"`
+}
+
+// CycloneDXBOM is the subset of a CycloneDX JSON BOM exposed to attribute
+// rules.
+type CycloneDXBOM struct {
+	BOMFormat    string                `json:"bomFormat" cel:"bomFormat"`
+	SpecVersion  string                `json:"specVersion" cel:"specVersion"`
+	SerialNumber string                `json:"serialNumber,omitempty" cel:"serialNumber"`
+	Version      int64                 `json:"version" cel:"version"`
+	Metadata     CycloneDXMetadata     `json:"metadata" cel:"metadata"`
+	Components   []CycloneDXComponent  `json:"components,omitempty" cel:"components"`
+	Dependencies []CycloneDXDependency `json:"dependencies,omitempty" cel:"dependencies"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp,omitempty" cel:"timestamp"`
+	Component CycloneDXComponent `json:"component" cel:"component"`
+}
+
+type CycloneDXComponent struct {
+	Type       string                   `json:"type" cel:"type"`
+	BOMRef     string                   `json:"bom-ref,omitempty" cel:"bomRef"`
+	Group      string                   `json:"group,omitempty" cel:"group"`
+	Name       string                   `json:"name" cel:"name"`
+	Version    string                   `json:"version,omitempty" cel:"version"`
+	PURL       string                   `json:"purl,omitempty" cel:"purl"`
+	Licenses   []CycloneDXLicenseChoice `json:"licenses,omitempty" cel:"licenses"`
+	Hashes     []CycloneDXHash          `json:"hashes,omitempty" cel:"hashes"`
+	Components []CycloneDXComponent     `json:"components,omitempty" cel:"components"`
+}
+
+type CycloneDXLicenseChoice struct {
+	License    CycloneDXLicense `json:"license" cel:"license"`
+	Expression string           `json:"expression,omitempty" cel:"expression"`
+}
+
+type CycloneDXLicense struct {
+	ID   string `json:"id,omitempty" cel:"id"`
+	Name string `json:"name,omitempty" cel:"name"`
+}
+
+type CycloneDXHash struct {
+	Algorithm string `json:"alg" cel:"alg"`
+	Content   string `json:"content" cel:"content"`
+}
+
+type CycloneDXDependency struct {
+	Ref       string   `json:"ref" cel:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty" cel:"dependsOn"`
+}
+
+// sbomComponent is a package or component listed in an SBOM, with its
+// license expressions.
+type sbomComponent struct {
+	name     string
+	purl     string
+	licenses []string
+}
+
+func (d SPDXDocument) components() []sbomComponent {
+	components := make([]sbomComponent, 0, len(d.Packages))
+	for _, pkg := range d.Packages {
+		component := sbomComponent{name: pkg.Name}
+
+		for _, ref := range pkg.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				component.purl = ref.ReferenceLocator
+				break
+			}
+		}
+
+		license := pkg.LicenseConcluded
+		if license == "" || license == "NOASSERTION" {
+			license = pkg.LicenseDeclared
+		}
+		if license == "" {
+			license = "NOASSERTION"
+		}
+		component.licenses = []string{license}
+
+		components = append(components, component)
+	}
+
+	return components
+}
+
+func (b CycloneDXBOM) components() []sbomComponent {
+	components := []sbomComponent{}
+
+	var walk func([]CycloneDXComponent)
+	walk = func(cdxComponents []CycloneDXComponent) {
+		for _, cdxComponent := range cdxComponents {
+			component := sbomComponent{name: cdxComponent.Name, purl: cdxComponent.PURL}
+			if cdxComponent.Group != "" {
+				component.name = cdxComponent.Group + "/" + cdxComponent.Name
+			}
+
+			for _, choice := range cdxComponent.Licenses {
+				switch {
+				case choice.Expression != "":
+					component.licenses = append(component.licenses, choice.Expression)
+				case choice.License.ID != "":
+					component.licenses = append(component.licenses, choice.License.ID)
+				case choice.License.Name != "":
+					component.licenses = append(component.licenses, choice.License.Name)
+				}
+			}
+			if len(component.licenses) == 0 {
+				component.licenses = []string{"NOASSERTION"}
+			}
+
+			components = append(components, component)
+			walk(cdxComponent.Components)
+		}
+	}
+	walk(b.Components)
+
+	return components
+}
+
+// sbomFunctions declares the SBOM helper functions as members of the CEL type
+// typeName, whose values are listed by components.
+func sbomFunctions(typeName string, components func(ref.Val) []sbomComponent) []cel.EnvOption {
+	sbomType := cel.ObjectType(typeName)
+	prefix := strings.ToLower(strings.TrimPrefix(typeName, "verifier.")) + "_"
+
+	return []cel.EnvOption{
+		cel.Function("licenses",
+			cel.MemberOverload(prefix+"licenses", []*cel.Type{sbomType}, cel.ListType(cel.StringType),
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					return types.DefaultTypeAdapter.NativeToValue(getLicenses(components(value)))
+				}),
+			),
+		),
+		cel.Function("licensesAllowed",
+			cel.MemberOverload(prefix+"licenses_allowed", []*cel.Type{sbomType, cel.ListType(cel.StringType)}, cel.BoolType,
+				cel.BinaryBinding(func(value, list ref.Val) ref.Val {
+					allowed, err := list.ConvertToNative(reflect.TypeOf([]string{}))
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					for _, component := range components(value) {
+						for _, license := range component.licenses {
+							if !licenseSatisfiable(license, func(id string) bool { return licenseListed(allowed.([]string), id) }) {
+								return types.False
+							}
+						}
+					}
+
+					return types.True
+				}),
+			),
+		),
+		cel.Function("licensesDenied",
+			cel.MemberOverload(prefix+"licenses_denied", []*cel.Type{sbomType, cel.ListType(cel.StringType)}, cel.BoolType,
+				cel.BinaryBinding(func(value, list ref.Val) ref.Val {
+					denied, err := list.ConvertToNative(reflect.TypeOf([]string{}))
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					for _, component := range components(value) {
+						for _, license := range component.licenses {
+							if !licenseSatisfiable(license, func(id string) bool { return !licenseListed(denied.([]string), id) }) {
+								return types.True
+							}
+						}
+					}
+
+					return types.False
+				}),
+			),
+		),
+		cel.Function("bannedComponents",
+			cel.MemberOverload(prefix+"banned_components", []*cel.Type{sbomType, cel.ListType(cel.StringType)}, cel.ListType(cel.StringType),
+				cel.BinaryBinding(func(value, list ref.Val) ref.Val {
+					banned, err := list.ConvertToNative(reflect.TypeOf([]string{}))
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					matched := []string{}
+					for _, component := range components(value) {
+						for _, spec := range banned.([]string) {
+							if component.purl != "" && purlMatches(component.purl, spec) {
+								matched = append(matched, component.purl)
+								break
+							}
+						}
+					}
+
+					return types.DefaultTypeAdapter.NativeToValue(matched)
+				}),
+			),
+		),
+		cel.Function("componentsWithoutPURL",
+			cel.MemberOverload(prefix+"components_without_purl", []*cel.Type{sbomType}, cel.ListType(cel.StringType),
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					unidentified := []string{}
+					for _, component := range components(value) {
+						if component.purl == "" {
+							unidentified = append(unidentified, component.name)
+						}
+					}
+
+					return types.DefaultTypeAdapter.NativeToValue(unidentified)
+				}),
+			),
+		),
+	}
+}
+
+// getLicenses returns the distinct license identifiers used by components.
+func getLicenses(components []sbomComponent) []string {
+	seen := map[string]bool{}
+	licenses := []string{}
+	for _, component := range components {
+		for _, expression := range component.licenses {
+			for _, id := range parseLicenseExpression(expression).ids() {
+				if !seen[id] {
+					seen[id] = true
+					licenses = append(licenses, id)
+				}
+			}
+		}
+	}
+	sort.Strings(licenses)
+
+	return licenses
+}
+
+// licenseListed reports whether the license id is in list. A license with an
+// exception is also listed if the license without the exception is.
+func licenseListed(list []string, id string) bool {
+	base, _, _ := strings.Cut(id, " WITH ")
+	for _, listed := range list {
+		if strings.EqualFold(listed, id) || strings.EqualFold(listed, base) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// licenseSatisfiable reports whether the SPDX license expression can be
+// satisfied using only licenses for which permitted returns true.
+func licenseSatisfiable(expression string, permitted func(string) bool) bool {
+	return parseLicenseExpression(expression).satisfiable(permitted)
+}
+
+// licenseExpression is a parsed SPDX license expression. Leaves hold a
+// license identifier, optionally with an exception.
+type licenseExpression struct {
+	id       string
+	operator string
+	operands []*licenseExpression
+}
+
+func (e *licenseExpression) satisfiable(permitted func(string) bool) bool {
+	switch e.operator {
+	case "AND":
+		for _, operand := range e.operands {
+			if !operand.satisfiable(permitted) {
+				return false
+			}
+		}
+		return true
+	case "OR":
+		for _, operand := range e.operands {
+			if operand.satisfiable(permitted) {
+				return true
+			}
+		}
+		return false
+	default:
+		return permitted(e.id)
+	}
+}
+
+func (e *licenseExpression) ids() []string {
+	if e.operator == "" {
+		return []string{e.id}
+	}
+
+	ids := []string{}
+	for _, operand := range e.operands {
+		ids = append(ids, operand.ids()...)
+	}
+
+	return ids
+}
+
+// parseLicenseExpression parses an SPDX license expression. Expressions that
+// cannot be parsed are treated as a single license identifier.
+func parseLicenseExpression(expression string) *licenseExpression {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	parser := &licenseParser{tokens: tokens}
+
+	parsed, ok := parser.parseOr()
+	if !ok || parser.position != len(tokens) {
+		return &licenseExpression{id: strings.TrimSpace(expression)}
+	}
+
+	return parsed
+}
+
+type licenseParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *licenseParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+
+	return ""
+}
+
+func (p *licenseParser) parseOr() (*licenseExpression, bool) {
+	return p.parseBinary("OR", p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (*licenseExpression, bool) {
+	return p.parseBinary("AND", p.parseWith)
+}
+
+func (p *licenseParser) parseBinary(operator string, operand func() (*licenseExpression, bool)) (*licenseExpression, bool) {
+	first, ok := operand()
+	if !ok {
+		return nil, false
+	}
+
+	operands := []*licenseExpression{first}
+	for strings.EqualFold(p.peek(), operator) {
+		p.position++
+		next, ok := operand()
+		if !ok {
+			return nil, false
+		}
+		operands = append(operands, next)
+	}
+
+	if len(operands) == 1 {
+		return first, true
+	}
+
+	return &licenseExpression{operator: operator, operands: operands}, true
+}
+
+func (p *licenseParser) parseWith() (*licenseExpression, bool) {
+	token := p.peek()
+	switch {
+	case token == "(":
+		p.position++
+		parsed, ok := p.parseOr()
+		if !ok || p.peek() != ")" {
+			return nil, false
+		}
+		p.position++
+		return parsed, true
+	case token == "" || token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") || strings.EqualFold(token, "WITH"):
+		return nil, false
+	}
+
+	p.position++
+	id := token
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.position++
+		exception := p.peek()
+		if exception == "" || exception == "(" || exception == ")" {
+			return nil, false
+		}
+		p.position++
+		id = token + " WITH " + exception
+	}
+
+	return &licenseExpression{id: id}, true
+}
+
+// purlMatches reports whether purl is matched by spec, a package URL without
+// a version optionally followed by @ and a version constraint. Constraints
+// are an exact version or comma separated comparisons such as >=1.0,<1.2.5.
+// A purl without a version could be any version, so it matches every
+// constraint.
+func purlMatches(purl, spec string) bool {
+	purlBase, purlVersion := splitPURL(purl)
+
+	specBase, constraint := spec, ""
+	if i := strings.LastIndex(spec, "@"); i > strings.LastIndex(spec, "/") {
+		specBase, constraint = spec[:i], spec[i+1:]
+	}
+	specBase, _ = splitPURL(specBase)
+
+	if purlBase != specBase {
+		return false
+	}
+
+	if constraint == "" || purlVersion == "" {
+		return true
+	}
+
+	for _, comparison := range strings.Split(constraint, ",") {
+		comparison = strings.TrimSpace(comparison)
+
+		operator := "="
+		for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(comparison, candidate) {
+				operator, comparison = candidate, strings.TrimSpace(comparison[len(candidate):])
+				break
+			}
+		}
+
+		result := compareVersions(purlVersion, comparison)
+		var satisfied bool
+		switch operator {
+		case ">=":
+			satisfied = result >= 0
+		case "<=":
+			satisfied = result <= 0
+		case ">":
+			satisfied = result > 0
+		case "<":
+			satisfied = result < 0
+		case "!=":
+			satisfied = result != 0
+		default:
+			satisfied = result == 0
+		}
+
+		if !satisfied {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitPURL returns the normalized package URL without its version,
+// qualifiers and subpath, and its version.
+func splitPURL(purl string) (string, string) {
+	normalized := normalizePURL(purl)
+	if i := strings.IndexAny(normalized, "?#"); i >= 0 {
+		normalized = normalized[:i]
+	}
+
+	if i := strings.LastIndex(normalized, "@"); i > strings.LastIndex(normalized, "/") {
+		return normalized[:i], normalized[i+1:]
+	}
+
+	return normalized, ""
+}
+
+// compareVersions compares dotted versions part by part, numerically where
+// both parts are numbers. As in semver, a pre-release sorts before its
+// release and build metadata is ignored.
+func compareVersions(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+
+	aRelease, aPrerelease, aIsPrerelease := strings.Cut(a, "-")
+	bRelease, bPrerelease, bIsPrerelease := strings.Cut(b, "-")
+
+	if result := compareVersionParts(strings.Split(aRelease, "."), strings.Split(bRelease, ".")); result != 0 {
+		return result
+	}
+
+	switch {
+	case aIsPrerelease && !bIsPrerelease:
+		return -1
+	case !aIsPrerelease && bIsPrerelease:
+		return 1
+	}
+
+	return compareVersionParts(strings.Split(aPrerelease, "."), strings.Split(bPrerelease, "."))
+}
+
+func compareVersionParts(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) {
+			return -1
+		}
+		if i >= len(b) {
+			return 1
+		}
+
+		aNumber, aErr := strconv.Atoi(a[i])
+		bNumber, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+		case a[i] != b[i]:
+			return strings.Compare(a[i], b[i])
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,202 @@
+package verifier
+
+import (
+	"reflect"
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestPURLMatches(t *testing.T) {
+	tests := []struct {
+		purl    string
+		spec    string
+		matched bool
+	}{
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo", true},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/bar", false},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@1.2.3", true},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@1.2.4", false},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@=1.2.3", true},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@>=1.0,<1.2.5", true},
+		{"pkg:npm/foo@1.2.5", "pkg:npm/foo@>=1.0,<1.2.5", false},
+		{"pkg:npm/foo@0.9", "pkg:npm/foo@>=1.0,<1.2.5", false},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@>= 1.0, < 2", true},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@!=1.2.3", false},
+		{"pkg:npm/foo@1.2.4", "pkg:npm/foo@!=1.2.3", true},
+		{"pkg:npm/foo@1.10.0", "pkg:npm/foo@>1.9", true},
+		{"pkg:npm/foo@1.2.3", "pkg:npm/foo@<=1.2.3", true},
+		{"pkg:npm/foo@2.0.0-rc.1", "pkg:npm/foo@<2.0.0", true},
+		{"pkg:npm/%40scope/foo@1.0.0", "pkg:npm/%40scope/foo@1.0.0", true},
+		{"pkg:npm/foo@1.0.0?arch=x64#lib", "pkg:npm/foo@1.0.0", true},
+		{"pkg:NPM/foo@1.0.0", "pkg:npm/foo", true},
+		{"pkg:pypi/Django_Rest@3.0", "pkg:pypi/django-rest@>=3", true},
+		{"pkg:npm/foo", "pkg:npm/foo@1.0.0", true},
+		{"pkg:npm/foo", "pkg:npm/foo@>=1.0,<1.2.5", true},
+		{"pkg:npm/bar", "pkg:npm/foo@1.0.0", false},
+	}
+
+	for _, test := range tests {
+		if matched := purlMatches(test.purl, test.spec); matched != test.matched {
+			t.Errorf("purlMatches(%q, %q) = %t, want %t", test.purl, test.spec, matched, test.matched)
+		}
+	}
+}
+
+func TestSplitPURL(t *testing.T) {
+	tests := []struct {
+		purl    string
+		base    string
+		version string
+	}{
+		{"pkg:npm/foo", "pkg:npm/foo", ""},
+		{"pkg:npm/foo@1.0.0", "pkg:npm/foo", "1.0.0"},
+		{"pkg:NPM/foo@1.0.0?arch=x64", "pkg:npm/foo", "1.0.0"},
+		{"pkg:golang/github.com/org/repo@v1.2.3#sub/dir", "pkg:golang/github.com/org/repo", "v1.2.3"},
+		{"pkg:npm/%40scope/foo@2.0.0", "pkg:npm/%40scope/foo", "2.0.0"},
+	}
+
+	for _, test := range tests {
+		base, version := splitPURL(test.purl)
+		if base != test.base || version != test.version {
+			t.Errorf("splitPURL(%q) = %q, %q, want %q, %q", test.purl, base, version, test.base, test.version)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		result int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0", "1.0.0", -1},
+		{"2", "10", -1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+		{"1.0.0a", "1.0.0b", -1},
+	}
+
+	for _, test := range tests {
+		if result := compareVersions(test.a, test.b); result != test.result {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, result, test.result)
+		}
+	}
+}
+
+func TestSBOMFunctions(t *testing.T) {
+	v, err := New(readTestLayout(t, "layout.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spdx, err := structpb.NewStruct(map[string]any{
+		"spdxVersion": "SPDX-2.3",
+		"packages": []any{
+			map[string]any{
+				"name":             "foo",
+				"licenseConcluded": "MIT OR GPL-3.0-only",
+				"externalRefs": []any{map[string]any{
+					"referenceCategory": "PACKAGE-MANAGER",
+					"referenceType":     "purl",
+					"referenceLocator":  "pkg:npm/foo@1.2.3",
+				}},
+			},
+			map[string]any{
+				"name":            "bar",
+				"licenseDeclared": "GPL-2.0-only WITH Classpath-exception-2.0",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cyclonedx, err := structpb.NewStruct(map[string]any{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"components": []any{
+			map[string]any{
+				"type":     "library",
+				"name":     "foo",
+				"purl":     "pkg:npm/foo",
+				"licenses": []any{map[string]any{"license": map[string]any{"id": "Apache-2.0"}}},
+				"components": []any{
+					map[string]any{"type": "library", "name": "baz", "group": "org"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := map[string]*attestationv1.Statement{
+		"spdx":      {PredicateType: "https://spdx.dev/Document/v2.3", Predicate: spdx},
+		"cyclonedx": {PredicateType: "https://cyclonedx.org/bom/v1.5", Predicate: cyclonedx},
+	}
+
+	tests := []struct {
+		statement  string
+		expression string
+		result     any
+	}{
+		{"spdx", "spdx.licenses()", []string{"GPL-2.0-only WITH Classpath-exception-2.0", "GPL-3.0-only", "MIT"}},
+		{"spdx", "spdx.licensesAllowed(['MIT', 'GPL-2.0-only'])", true},
+		{"spdx", "spdx.licensesAllowed(['MIT', 'Classpath-exception-2.0'])", false},
+		{"spdx", "spdx.licensesAllowed(['GPL-3.0-only', 'GPL-2.0-only WITH Classpath-exception-2.0'])", true},
+		{"spdx", "spdx.licensesAllowed(['GPL-2.0-only'])", false},
+		{"spdx", "spdx.licensesDenied(['GPL-3.0-only'])", false},
+		{"spdx", "spdx.licensesDenied(['MIT', 'GPL-3.0-only'])", true},
+		{"spdx", "spdx.licensesDenied(['gpl-2.0-only'])", true},
+		{"spdx", "spdx.bannedComponents(['pkg:npm/foo@>=1.0,<1.2.5'])", []string{"pkg:npm/foo@1.2.3"}},
+		{"spdx", "spdx.bannedComponents(['pkg:npm/foo@<1.0'])", []string{}},
+		{"spdx", "spdx.componentsWithoutPURL()", []string{"bar"}},
+		{"cyclonedx", "cyclonedx.licensesAllowed(['Apache-2.0'])", false},
+		{"cyclonedx", "cyclonedx.licensesAllowed(['Apache-2.0', 'NOASSERTION'])", true},
+		{"cyclonedx", "cyclonedx.licensesDenied(['NOASSERTION'])", true},
+		{"cyclonedx", "cyclonedx.licensesDenied(['MIT'])", false},
+		{"cyclonedx", "cyclonedx.bannedComponents(['pkg:npm/foo@<1.0'])", []string{"pkg:npm/foo"}},
+		{"cyclonedx", "cyclonedx.componentsWithoutPURL()", []string{"org/baz"}},
+	}
+
+	cache := &statementCache{}
+	for _, test := range tests {
+		statement := statements[test.statement]
+
+		input, err := cache.activation(statement, v.options.registry.Handler(statement.PredicateType), log.StandardLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		programs, err := v.getPrograms(statement.PredicateType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := programs.program(test.expression)
+		if err != nil {
+			t.Fatalf("compiling %s: %s", test.expression, err)
+		}
+
+		out, _, err := program.Eval(input)
+		if err != nil {
+			t.Fatalf("evaluating %s: %s", test.expression, err)
+		}
+
+		result, err := out.ConvertToNative(reflect.TypeOf(test.result))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%s = %v, want %v", test.expression, result, test.result)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// AttestationSource provides attestations to a Verifier, named as the
+// attestations passed to Verify are.
+type AttestationSource interface {
+	Attestations(ctx context.Context) (map[string]*dsse.Envelope, error)
+}
+
+// DirectorySource reads DSSE envelopes from a directory each time
+// attestations are requested. Links and subdirectories are skipped, and a
+// ".json" extension is removed from attestation names.
+type DirectorySource struct {
+	Dir string
+}
+
+func (d *DirectorySource) Attestations(ctx context.Context) (map[string]*dsse.Envelope, error) {
+	dirEntries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	attestations := map[string]*dsse.Envelope{}
+	for _, e := range dirEntries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := e.Name()
+		if e.IsDir() || strings.HasSuffix(name, ".link") {
+			continue
+		}
+
+		ab, err := os.ReadFile(filepath.Join(d.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		envelope := &dsse.Envelope{}
+		if err := json.Unmarshal(ab, envelope); err != nil {
+			return nil, fmt.Errorf("unable to load attestation %s: %w", name, err)
+		}
+
+		attestations[strings.TrimSuffix(name, ".json")] = envelope
+	}
+
+	return attestations, nil
+}
@@ -0,0 +1,148 @@
+package verifier
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/interpreter"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// statementCache holds what the verifier derives from each statement during a
+// verification, so that a statement's predicate is decoded once however many
+// artifact rules, MATCH rules and claims use it.
+type statementCache struct {
+	mu         sync.Mutex
+	statements map[*attestationv1.Statement]*parsedStatement
+}
+
+// parsedStatement is a statement's typed CEL input, attribute rule input,
+// materials and products, each computed on first use. Materials and products
+// are kept for each handler, as steps can compute them differently.
+type parsedStatement struct {
+	typedOnce  sync.Once
+	typedInput map[string]any
+	typedErr   error
+
+	activationOnce sync.Once
+	activation     interpreter.Activation
+	activationErr  error
+
+	mu        sync.Mutex
+	artifacts map[PredicateHandler]*statementArtifacts
+}
+
+// statementArtifacts are the materials and products a handler extracts from
+// a statement.
+type statementArtifacts struct {
+	once      sync.Once
+	materials []*attestationv1.ResourceDescriptor
+	products  []*attestationv1.ResourceDescriptor
+	err       error
+}
+
+// artifactsFor returns the statement's artifacts for the handler. Handlers
+// that cannot be map keys get artifacts that are not kept.
+func (p *parsedStatement) artifactsFor(handler PredicateHandler) *statementArtifacts {
+	if !reflect.TypeOf(handler).Comparable() {
+		return &statementArtifacts{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.artifacts == nil {
+		p.artifacts = map[PredicateHandler]*statementArtifacts{}
+	}
+
+	artifacts, ok := p.artifacts[handler]
+	if !ok {
+		artifacts = &statementArtifacts{}
+		p.artifacts[handler] = artifacts
+	}
+
+	return artifacts
+}
+
+func (c *statementCache) get(statement *attestationv1.Statement) *parsedStatement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.statements == nil {
+		c.statements = map[*attestationv1.Statement]*parsedStatement{}
+	}
+
+	parsed, ok := c.statements[statement]
+	if !ok {
+		parsed = &parsedStatement{}
+		c.statements[statement] = parsed
+	}
+
+	return parsed
+}
+
+// typedInput returns the typed CEL variables the handler provides for the
+// statement.
+func (c *statementCache) typedInput(statement *attestationv1.Statement, handler TypedPredicateHandler) (map[string]any, error) {
+	parsed := c.get(statement)
+	parsed.typedOnce.Do(func() {
+		parsed.typedInput, parsed.typedErr = handler.CELInput(statement)
+	})
+
+	return parsed.typedInput, parsed.typedErr
+}
+
+// activation returns the input attribute rules are evaluated against for the
+// statement.
+func (c *statementCache) activation(statement *attestationv1.Statement, handler PredicateHandler, logger log.FieldLogger) (interpreter.Activation, error) {
+	parsed := c.get(statement)
+	parsed.activationOnce.Do(func() {
+		input := map[string]any{
+			"type":          statement.Type,
+			"subject":       statement.Subject,
+			"predicateType": statement.PredicateType,
+			"predicate":     statement.Predicate,
+		}
+
+		if typed, ok := handler.(TypedPredicateHandler); ok {
+			// Attribute rules using the untyped predicate keep working for
+			// predicates that do not match the handler's schema.
+			typedInput, err := c.typedInput(statement, typed)
+			if err != nil {
+				logger.Warnf("Unable to decode predicate of type %s: %s", statement.PredicateType, err)
+			}
+
+			for name, value := range typedInput {
+				input[name] = value
+			}
+		}
+
+		parsed.activation, parsed.activationErr = interpreter.NewActivation(input)
+	})
+
+	return parsed.activation, parsed.activationErr
+}
+
+// materialsAndProducts returns the artifacts the handler extracts from the
+// statement. Built-in handlers extract them from the typed predicate shared
+// with attribute rules.
+func (c *statementCache) materialsAndProducts(handler PredicateHandler, statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	artifacts := c.get(statement).artifactsFor(handler)
+	artifacts.once.Do(func() {
+		if builtin, ok := handler.(*builtinHandler); ok && builtin.typedArtifacts != nil {
+			typedInput, err := c.typedInput(statement, builtin)
+			if err != nil {
+				artifacts.err = err
+				return
+			}
+
+			artifacts.materials, artifacts.products = builtin.typedArtifacts(typedInput[builtin.variable], statement)
+			return
+		}
+
+		artifacts.materials, artifacts.products, artifacts.err = handler.MaterialsAndProducts(statement)
+	})
+
+	return artifacts.materials, artifacts.products, artifacts.err
+}
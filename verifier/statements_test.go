@@ -0,0 +1,120 @@
+package verifier
+
+import (
+	"sync/atomic"
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// countingHandler treats a statement's subject as its products and counts
+// how often it is asked to.
+type countingHandler struct {
+	calls atomic.Int32
+}
+
+func (h *countingHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	h.calls.Add(1)
+	return nil, statement.Subject, nil
+}
+
+func TestStatementCache(t *testing.T) {
+	predicate, err := structpb.NewStruct(map[string]any{"name": "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := &attestationv1.Statement{
+		Subject:       []*attestationv1.ResourceDescriptor{{Name: "foo", Digest: map[string]string{"sha256": "aa"}}},
+		PredicateType: linkPredicateType,
+		Predicate:     predicate,
+	}
+	other := &attestationv1.Statement{Subject: []*attestationv1.ResourceDescriptor{{Name: "bar", Digest: map[string]string{"sha256": "bb"}}}}
+
+	cache := &statementCache{}
+	handler := &countingHandler{}
+	for i := 0; i < 3; i++ {
+		if _, products, err := cache.materialsAndProducts(handler, statement); err != nil || len(products) != 1 || products[0].Name != "foo" {
+			t.Fatalf("products %v, error %v, want foo", products, err)
+		}
+	}
+	if calls := handler.calls.Load(); calls != 1 {
+		t.Errorf("handler called %d times for one statement, want once", calls)
+	}
+
+	if _, products, _ := cache.materialsAndProducts(handler, other); len(products) != 1 || products[0].Name != "bar" {
+		t.Errorf("products %v for another statement, want bar", products)
+	}
+	otherHandler := &countingHandler{}
+	cache.materialsAndProducts(otherHandler, statement)
+	if handler.calls.Load() != 2 || otherHandler.calls.Load() != 1 {
+		t.Errorf("handlers called %d and %d times, want each statement and handler once", handler.calls.Load(), otherHandler.calls.Load())
+	}
+
+	// Typed inputs are decoded once too
+	typed := NewPredicateRegistry().Handler(linkPredicateType).(TypedPredicateHandler)
+	first, err := cache.typedInput(statement, typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := cache.typedInput(statement, typed)
+	if first["link"] != second["link"] {
+		t.Error("typed input decoded again")
+	}
+}
+
+func TestDestinationCache(t *testing.T) {
+	handler := &countingHandler{}
+	registry := NewPredicateRegistry()
+	if err := registry.Register("https://example.com/build/v1", handler); err != nil {
+		t.Fatal(err)
+	}
+	handlers := &artifactHandlers{registry: registry}
+
+	claim := func(name, digest string) *attestationv1.Statement {
+		return &attestationv1.Statement{
+			PredicateType: "https://example.com/build/v1",
+			Subject:       []*attestationv1.ResourceDescriptor{{Name: name, Digest: map[string]string{"sha256": digest}}},
+		}
+	}
+	alice := AttestationIdentifier{PredicateType: "https://example.com/build/v1", Functionary: "alice"}
+	bob := AttestationIdentifier{PredicateType: "https://example.com/build/v1", Functionary: "bob"}
+
+	claims := map[AttestationIdentifier]*attestationv1.Statement{alice: claim("foo", "aa")}
+	first, err := handlers.destinations.get(handlers, "build", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := handlers.destinations.get(handlers, "build", map[AttestationIdentifier]*attestationv1.Statement{alice: claims[alice]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || handler.calls.Load() != 1 {
+		t.Errorf("destination artifacts collected %d times for the same claims, want once", handler.calls.Load())
+	}
+
+	tests := []struct {
+		name    string
+		dstName string
+		claims  map[AttestationIdentifier]*attestationv1.Statement
+		product string
+	}{
+		{"other step", "package", claims, "foo"},
+		{"other statement", "build", map[AttestationIdentifier]*attestationv1.Statement{alice: claim("bar", "bb")}, "bar"},
+		{"other functionary", "build", map[AttestationIdentifier]*attestationv1.Statement{bob: claims[alice]}, "foo"},
+		{"more claims", "build", map[AttestationIdentifier]*attestationv1.Statement{alice: claims[alice], bob: claim("baz", "cc")}, "baz"},
+	}
+
+	for _, test := range tests {
+		destination, err := handlers.destinations.get(handlers, test.dstName, test.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if destination == first {
+			t.Errorf("%s: destination artifacts of other claims reused", test.name)
+		}
+		if _, ok := destination.products[test.product]; !ok {
+			t.Errorf("%s: products %v, want %s", test.name, destination.products, test.product)
+		}
+	}
+}
@@ -2,63 +2,306 @@ package verifier
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/cel-go/cel"
-	"github.com/google/cel-go/interpreter"
 	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
 )
 
-func Verify(layout *Layout, attestations map[string]*dsse.Envelope, parameters map[string]string) error {
-	log.Info("Verifying layout expiry...")
+func Verify(layout *Layout, attestations map[string]*dsse.Envelope, parameters map[string]string, opts ...Option) error {
+	return VerifyContext(context.Background(), layout, attestations, parameters, opts...)
+}
+
+// VerifyContext is Verify with a context. Verification stops when the
+// context is done, returning an error wrapping the context's error.
+func VerifyContext(ctx context.Context, layout *Layout, attestations map[string]*dsse.Envelope, parameters map[string]string, opts ...Option) error {
+	_, err := VerifyWithResultContext(ctx, layout, attestations, parameters, opts...)
+	return err
+}
+
+// VerifyWithResult verifies the attestations against the layout like Verify,
+// and describes a successful verification for issuing a verification summary.
+func VerifyWithResult(layout *Layout, attestations map[string]*dsse.Envelope, parameters map[string]string, opts ...Option) (*Result, error) {
+	return VerifyWithResultContext(context.Background(), layout, attestations, parameters, opts...)
+}
+
+// VerifyWithResultContext is VerifyWithResult with a context.
+func VerifyWithResultContext(ctx context.Context, layout *Layout, attestations map[string]*dsse.Envelope, parameters map[string]string, opts ...Option) (*Result, error) {
+	v, err := New(layout, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.VerifyContext(ctx, attestations, parameters)
+}
+
+// ErrAborted is wrapped by the errors of verifications stopped because their
+// context is done. The errors also wrap the context's error.
+var ErrAborted = errors.New("verification aborted")
+
+// checkContext returns an error wrapping ErrAborted and the context's error
+// if ctx is done.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrAborted, err)
+	}
+
+	return nil
+}
+
+// Verifier verifies attestations against a layout. It holds the layout's
+// functionary keys and the CEL programs compiled for its rules, and is safe
+// for concurrent use.
+type Verifier struct {
+	layoutBytes     []byte
+	expiry          time.Time
+	options         *verifyOptions
+	functionaryKeys map[string]functionaryKey
+	verifiers       []dsse.Verifier
+	env             *cel.Env
+
+	// keysDigest and optionsDigest are part of the cache keys of signature
+	// checks and results
+	keysDigest    []byte
+	optionsDigest []byte
+
+	// expressions are the layout's CEL expressions before parameters are
+	// substituted
+	expressions map[string]bool
+
+	mu       sync.Mutex
+	programs map[string]*programCache
+}
+
+// New returns a verifier for the layout. Later changes to the layout do not
+// affect the verifier.
+func New(layout *Layout, opts ...Option) (*Verifier, error) {
+	options := &verifyOptions{
+		registry:    defaultPredicateRegistry,
+		logger:      log.StandardLogger(),
+		clock:       time.Now,
+		concurrency: runtime.GOMAXPROCS(0),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	expiry, err := time.Parse(time.RFC3339, layout.Expires)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Parameters are substituted in a copy of the layout for each
+	// verification
+	layoutBytes, err := yaml.Marshal(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	options.logger.Info("Fetching verifiers...")
+	functionaryKeys, err := getFunctionaryKeys(layout.Functionaries)
+	if err != nil {
+		return nil, err
+	}
+	verifiers, err := getVerifiers(layout.Functionaries, options.logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(verifiers) == 0 {
+		return nil, fmt.Errorf("no usable functionary keys in layout")
+	}
+	options.logger.Info("Done.")
+
+	if options.revocations != nil {
+		options.logger.Info("Verifying revocation list...")
+		if err := options.revocations.verify(layout, functionaryKeys, options.logger); err != nil {
+			return nil, err
+		}
+		options.logger.Info("Done.")
+	}
+
+	env, err := getCELEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	keysKey := newCacheKey("keys")
+	if err := keysKey.addJSON(layout.Functionaries); err != nil {
+		return nil, err
+	}
+
+	optionsDigest, err := getOptionsDigest(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields are returned unchanged, so the walk cannot fail
+	expressions := map[string]bool{}
+	_ = walkParameterFields(layout, func(kind int, field string) (string, error) {
+		if kind == celParameterField {
+			expressions[field] = true
+		}
+
+		return field, nil
+	})
+
+	return &Verifier{
+		layoutBytes:     layoutBytes,
+		expiry:          expiry,
+		options:         options,
+		functionaryKeys: functionaryKeys,
+		verifiers:       verifiers,
+		env:             env,
+		keysDigest:      keysKey.h.Sum(nil),
+		optionsDigest:   optionsDigest,
+		expressions:     expressions,
+		programs:        map[string]*programCache{},
+	}, nil
+}
+
+// Verify verifies the attestations, together with those from the verifier's
+// attestation sources, against the layout with parameters substituted.
+func (v *Verifier) Verify(attestations map[string]*dsse.Envelope, parameters map[string]string) (*Result, error) {
+	return v.VerifyContext(context.Background(), attestations, parameters)
+}
+
+// VerifyContext is Verify with a context. Signature checks, attestation
+// sources and CEL evaluation stop when the context is done, and the returned
+// error wraps ErrAborted and the context's error.
+func (v *Verifier) VerifyContext(ctx context.Context, attestations map[string]*dsse.Envelope, parameters map[string]string) (*Result, error) {
+	logger := v.options.logger
+
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Verifying layout expiry...")
+	now := v.options.clock()
+	if compare := v.expiry.Compare(now); compare == -1 {
+		return nil, fmt.Errorf("layout has expired")
+	}
+	logger.Info("Done.")
+
+	layout, err := ParseLayout(v.layoutBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	attestations, err = v.getAttestations(ctx, attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	resultKey := ""
+	if v.options.cache != nil && v.options.cache.TimeBucket > 0 {
+		resultKey, err = v.resultCacheKey(attestations, parameters, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if result, ok := v.loadCachedResult(resultKey); ok {
+			logger.Infof("Using cached result of verification at %s", result.VerifiedAt.Format(time.RFC3339))
+			logger.Info("Verification successful!")
+			return result, nil
+		}
+	}
+
+	// The built-in handler for vulnerability scans is set up with the time
+	// of verification, exceptions and VEX statements. Handlers registered in
+	// its place are used as they are.
+	registry := v.options.registry
+	if _, ok := registry.Handler(vulnsPredicateType).(*vulnsHandler); ok {
+		registry = registry.clone()
+		registry.handlers[vulnsPredicateType] = &vulnsHandler{
+			suppressions: &vulnSuppressions{
+				exceptions: v.options.vulnExceptions,
+				vex:        v.options.vexDocuments,
+				now:        now,
+			},
+			now: now,
+		}
 	}
 
-	if compare := expiry.Compare(time.Now()); compare == -1 {
-		return fmt.Errorf("layout has expired")
+	result := &Result{
+		VerifiedAt:   now,
+		Attestations: map[string]map[string]string{},
 	}
-	log.Info("Done.")
 
 	if len(parameters) > 0 {
-		log.Info("Substituting parameters...")
+		logger.Info("Substituting parameters...")
 		layout, err = substituteParameters(layout, parameters)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		log.Info("Done.")
+		logger.Info("Done.")
 	}
 
-	log.Info("Fetching verifiers...")
-	verifiers, err := getVerifiers(layout.Functionaries)
-	if err != nil {
-		return err
+	if err := layout.DigestPolicy.validate(); err != nil {
+		return nil, err
 	}
-	envVerifier, err := dsse.NewEnvelopeVerifier(verifiers...)
-	if err != nil {
-		return err
+
+	for _, step := range layout.Steps {
+		if step.Command != "" && len(step.CommandArgs) > 0 {
+			return nil, fmt.Errorf("step %s: only one of command and commandArgs can be set", step.Name)
+		}
+
+		if err := step.ExpectedVSA.validate(); err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
 	}
-	log.Info("Done.")
 
-	log.Info("Loading attestations as claims...")
-	claims := map[string]map[AttestationIdentifier]*attestationv1.Statement{}
+	// Attestations are indexed by the step their name refers to, or by the
+	// layout subject their statement is about. Those the layout does not use
+	// are reported, and in lazy mode are not verified at all.
+	usedSteps := getUsedSteps(layout)
+
+	logger.Info("Loading attestations as claims...")
+	attestationNames := make([]string, 0, len(attestations))
 	for attestationName, env := range attestations {
+		if !usedSteps[getStepName(attestationName)] && !aboutLayoutSubjects(layout, env, v.options.limits) {
+			result.Unused = append(result.Unused, attestationName)
+			if v.options.lazy {
+				continue
+			}
+		}
+		attestationNames = append(attestationNames, attestationName)
+	}
+	sort.Strings(attestationNames)
+
+	// Signatures are verified in parallel, and the verified envelopes are
+	// added as claims in the order of their names
+	envelopes := make([]*verifiedEnvelope, len(attestationNames))
+	envelopeErrs := make([]error, len(attestationNames))
+	parallelize(v.options.concurrency, len(attestationNames), func(i int) {
+		envelopes[i], envelopeErrs[i] = v.verifyEnvelope(ctx, attestationNames[i], attestations[attestationNames[i]])
+	})
+
+	claims := map[string]map[AttestationIdentifier]*attestationv1.Statement{}
+	for i, attestationName := range attestationNames {
+		if envelopeErrs[i] != nil {
+			return nil, envelopeErrs[i]
+		}
+
 		stepName := getStepName(attestationName)
 		if claims[stepName] == nil {
 			claims[stepName] = map[AttestationIdentifier]*attestationv1.Statement{}
 		}
 
-		acceptedKeys, err := envVerifier.Verify(context.Background(), env)
-		if err != nil {
+		envelope := envelopes[i]
+		if envelope == nil {
 			// The verifier loads all attestations and verifies their
 			// signatures. It represents their claims in the format "<signer>
 			// says <claim> for <step>", allowing policy to be written as "does
@@ -71,91 +314,530 @@ func Verify(layout *Layout, attestations map[string]*dsse.Envelope, parameters m
 			// from the layout.  If we encounter an attestation signed by an
 			// unrecognized key, the verifier logs this and moves on. This
 			// attestation is not considered for further verification.
-			log.Infof("Unable to verify %s's signatures", attestationName)
+			logger.Infof("Unable to verify %s's signatures", attestationName)
+			continue
+		}
+
+		if v.addClaims(claims[stepName], attestationName, envelope.payload, envelope.statement, envelope.keyIDs) {
+			result.Attestations[attestationName] = getAttestationDigest(envelope.payload)
+		}
+	}
+
+	for linkName, link := range v.options.links {
+		classicLink, ok := link.GetPayload().(in_toto.Link)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an in-toto link", linkName)
+		}
+
+		if !usedSteps[classicLink.Name] {
+			result.Unused = append(result.Unused, linkName)
+			if v.options.lazy {
+				continue
+			}
+		}
+
+		keyIDs, payload, err := verifyLink(link, v.functionaryKeys)
+		if err != nil {
+			logger.Infof("Unable to verify %s's signatures", linkName)
 			continue
 		}
 
-		sb, err := env.DecodeB64Payload()
+		statement, err := linkToStatement(classicLink)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("unable to load link %s: %w", linkName, err)
 		}
 
-		statement := &attestationv1.Statement{}
-		if err := protojson.Unmarshal(sb, statement); err != nil {
-			return err
+		if claims[classicLink.Name] == nil {
+			claims[classicLink.Name] = map[AttestationIdentifier]*attestationv1.Statement{}
 		}
 
-		for _, ak := range acceptedKeys {
-			claims[stepName][AttestationIdentifier{Functionary: ak.KeyID, PredicateType: statement.PredicateType}] = statement
+		if v.addClaims(claims[classicLink.Name], linkName, payload, statement, keyIDs) {
+			result.Attestations[linkName] = getAttestationDigest(payload)
 		}
 	}
-	log.Info("Done.")
+	logger.Info("Done.")
 
-	env, err := getCELEnv()
+	sort.Strings(result.Unused)
+	for _, name := range result.Unused {
+		logger.Infof("%s is not used by any step in the layout", name)
+	}
+
+	artifactHandlers, err := getArtifactHandlers(ctx, layout, v.getPrograms, registry, logger)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, step := range layout.Steps {
+	// Claims are evaluated in parallel. Their outcomes are then considered in
+	// the order of the layout's steps, so the error returned for a failed
+	// verification does not depend on scheduling. Planning stops at the first
+	// step that cannot be met whatever its claims' outcomes.
+	predicateChecks := []*predicateCheck{}
+	claimChecks := []*claimCheck{}
+planning:
+	for i, step := range layout.Steps {
 		stepStatements, ok := claims[step.Name]
 		if !ok {
-			return fmt.Errorf("no claims found for step %s", step.Name)
+			predicateChecks = append(predicateChecks, &predicateCheck{err: fmt.Errorf("no claims found for step %s", step.Name)})
+			break
 		}
 
-		for _, expectedPredicate := range step.ExpectedPredicates {
+		for _, expectedPredicate := range getExpectedPredicates(step) {
 			if expectedPredicate.Threshold == 0 {
 				expectedPredicate.Threshold = 1
 			}
 
-			matchedPredicates := getPredicates(stepStatements, expectedPredicate.PredicateType, expectedPredicate.Functionaries)
-			if len(matchedPredicates) < expectedPredicate.Threshold {
-				return fmt.Errorf("threshold not met for step %s", step.Name)
+			functionaries := make([]string, 0, len(expectedPredicate.Functionaries))
+			for _, reference := range expectedPredicate.Functionaries {
+				functionaries = append(functionaries, resolveFunctionary(layout.Functionaries, v.functionaryKeys, reference))
 			}
 
-			failedChecks := []error{}
-			acceptedPredicates := 0
-			for functionary, statement := range matchedPredicates {
-				log.Infof("Verifying claim for step '%s' of type '%s' by '%s'...", step.Name, expectedPredicate.PredicateType, functionary)
-				failed := false
+			matchedPredicates := getPredicates(stepStatements, expectedPredicate.PredicateType, functionaries)
+			if len(matchedPredicates) < expectedPredicate.Threshold {
+				predicateChecks = append(predicateChecks, &predicateCheck{err: fmt.Errorf("threshold not met for step %s", step.Name)})
+				break planning
+			}
 
-				if err := applyArtifactRules(statement, step.ExpectedMaterials, step.ExpectedProducts, claims); err != nil {
-					failed = true
-					failedChecks = append(failedChecks, fmt.Errorf("for step %s, claim by %s failed artifact rules: %w", step.Name, functionary, err))
+			matchedFunctionaries := make([]string, 0, len(matchedPredicates))
+			for functionary := range matchedPredicates {
+				matchedFunctionaries = append(matchedFunctionaries, functionary)
+			}
+			sort.Strings(matchedFunctionaries)
+
+			check := &predicateCheck{threshold: expectedPredicate.Threshold}
+			for _, functionary := range matchedFunctionaries {
+				claim := &claimCheck{
+					step:              step,
+					expectedPredicate: expectedPredicate,
+					functionary:       functionary,
+					statement:         matchedPredicates[functionary],
+					lastStep:          i == len(layout.Steps)-1,
 				}
+				check.claims = append(check.claims, claim)
+				claimChecks = append(claimChecks, claim)
+			}
+			predicateChecks = append(predicateChecks, check)
+		}
+	}
 
-				input, err := getActivation(statement)
-				if err != nil {
-					return err
-				}
+	// MATCH rules and subject checks only consider the destination step's
+	// claims that its own checks would consider
+	authorizedClaims := getAuthorizedClaims(layout, v.functionaryKeys, claims)
+	parallelize(v.options.concurrency, len(claimChecks), func(i int) {
+		v.checkClaim(ctx, claimChecks[i], layout, authorizedClaims, artifactHandlers, registry)
+	})
 
-				if err := applyAttributeRules(env, input, expectedPredicate.ExpectedAttributes); err != nil {
-					failed = true
-					failedChecks = append(failedChecks, fmt.Errorf("for step %s, claim by %s failed attribute rules: %w", step.Name, functionary, err))
-				}
+	for _, check := range predicateChecks {
+		if check.err != nil {
+			return nil, check.err
+		}
+
+		failedChecks := []error{}
+		acceptedPredicates := 0
+		for _, claim := range check.claims {
+			if claim.err != nil {
+				return nil, claim.err
+			}
+
+			if len(claim.failedChecks) > 0 {
+				failedChecks = append(failedChecks, claim.failedChecks...)
+				continue
+			}
+
+			acceptedPredicates += 1
+			if err := result.addProducts(claim.products, layout.DigestPolicy); err != nil {
+				return nil, fmt.Errorf("for step %s, claim by %s: %w", claim.step.Name, claim.functionary, err)
+			}
+			result.SkippedRules = append(result.SkippedRules, claim.skippedRules...)
+		}
+		if acceptedPredicates < check.threshold {
+			return nil, errors.Join(failedChecks...)
+		}
+	}
+
+	if resultKey != "" {
+		if err := v.storeCachedResult(resultKey, result); err != nil {
+			logger.Warnf("Unable to cache verification result: %s", err)
+		}
+	}
+
+	logger.Info("Verification successful!")
+
+	return result, nil
+}
+
+// getUsedSteps returns the names of the layout's steps and of the steps its
+// MATCH rules and subject checks refer to.
+func getUsedSteps(layout *Layout) map[string]bool {
+	usedSteps := map[string]bool{}
+	for _, step := range layout.Steps {
+		usedSteps[step.Name] = true
+
+		for _, r := range append(append([]string{}, step.ExpectedMaterials...), step.ExpectedProducts...) {
+			rule, err := unpackRule(r)
+			if err != nil {
+				// Invalid rules are reported when they are applied
+				continue
+			}
+			if rule["type"] == "match" {
+				usedSteps[rule["dstName"]] = true
+			}
+		}
+
+		for _, expectedPredicate := range step.ExpectedPredicates {
+			if expectedPredicate.SubjectMatchesProductsOf != "" {
+				usedSteps[expectedPredicate.SubjectMatchesProductsOf] = true
+			}
+		}
+	}
+
+	return usedSteps
+}
+
+// UsesAttestation reports whether lazy verification against the layout may
+// need the named attestation: its name refers to a step the layout uses, or
+// the layout declares subjects, which attestations named after any step can
+// be about. Callers loading attestations for lazy verification can pass a nil
+// envelope for the others, which are listed as unused without being read.
+func UsesAttestation(layout *Layout, attestationName string) bool {
+	return len(layout.Subjects) > 0 || getUsedSteps(layout)[getStepName(attestationName)]
+}
+
+// aboutLayoutSubjects reports whether the statement in env has a subject
+// matching one of the layout's subjects. Its signatures are not checked, as
+// this only decides whether the attestation is verified. Payloads over the
+// size limit are reported as matching, so that verifying them fails.
+func aboutLayoutSubjects(layout *Layout, env *dsse.Envelope, limits Limits) bool {
+	if len(layout.Subjects) == 0 || env == nil {
+		return false
+	}
+
+	if limits.MaxPayloadBytes > 0 && base64.StdEncoding.DecodedLen(len(env.Payload)) > limits.MaxPayloadBytes {
+		return true
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return false
+	}
+	statement := &attestationv1.Statement{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(payload, statement); err != nil {
+		return false
+	}
 
-				if failed {
-					log.Infof("Claim for step %s of type %s by %s failed.", step.Name, expectedPredicate.PredicateType, functionary)
-				} else {
-					acceptedPredicates += 1
-					log.Info("Done.")
+	for _, subject := range layout.Subjects {
+		for _, patternString := range subject.Subject {
+			pattern, err := compileArtifactPattern(layout.ArtifactPatternMode, normalizeArtifactName(patternString))
+			if err != nil {
+				// An invalid pattern cannot rule the attestation out
+				return true
+			}
+
+			for _, artifact := range statement.Subject {
+				if matched, err := pattern.match(normalizeArtifactName(artifact.Name)); matched || err != nil {
+					return true
 				}
 			}
-			if acceptedPredicates < expectedPredicate.Threshold {
-				return errors.Join(failedChecks...)
+		}
+	}
+
+	return false
+}
+
+// verifiedEnvelope is an attestation whose signatures were verified.
+type verifiedEnvelope struct {
+	payload   []byte
+	statement *attestationv1.Statement
+	keyIDs    []string
+}
+
+// verifyEnvelope verifies the signatures of the named attestation and loads
+// its statement. It returns nil if no functionary's signature verifies.
+func (v *Verifier) verifyEnvelope(ctx context.Context, attestationName string, env *dsse.Envelope) (*verifiedEnvelope, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if env == nil {
+		return nil, fmt.Errorf("attestation %s was not loaded", attestationName)
+	}
+
+	if limit := v.options.limits.MaxPayloadBytes; limit > 0 && base64.StdEncoding.DecodedLen(len(env.Payload)) > limit {
+		return nil, fmt.Errorf("attestation %s exceeds the payload size limit of %d bytes", attestationName, limit)
+	}
+
+	keyIDs, verified, err := v.verifySignatures(ctx, env)
+	if err != nil || !verified {
+		return nil, err
+	}
+
+	sb, err := env.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &attestationv1.Statement{}
+	if err := protojson.Unmarshal(sb, statement); err != nil {
+		return nil, err
+	}
+
+	return &verifiedEnvelope{payload: sb, statement: statement, keyIDs: keyIDs}, nil
+}
+
+// verifySignatures returns the IDs of the functionary keys whose signatures
+// on the envelope verify, and whether any did. Outcomes are read from and
+// written to the cache, if one is set.
+func (v *Verifier) verifySignatures(ctx context.Context, env *dsse.Envelope) ([]string, bool, error) {
+	cacheKey := ""
+	if v.options.cache != nil {
+		var err error
+		cacheKey, err = v.signatureCacheKey(env)
+		if err != nil {
+			return nil, false, err
+		}
+
+		cached := &signatureCacheValue{}
+		if v.options.cache.load(signatureCacheEntry, cacheKey, cached) {
+			return cached.KeyIDs, cached.Verified, nil
+		}
+	}
+
+	envVerifier, err := newEnvelopeVerifier(1, v.verifiers)
+	if err != nil {
+		return nil, false, err
+	}
+
+	outcome := &signatureCacheValue{}
+	acceptedKeys, err := envVerifier.Verify(ctx, env)
+	if err != nil {
+		if err := checkContext(ctx); err != nil {
+			return nil, false, err
+		}
+	} else {
+		outcome.Verified = true
+		outcome.KeyIDs = make([]string, 0, len(acceptedKeys))
+		for _, ak := range acceptedKeys {
+			outcome.KeyIDs = append(outcome.KeyIDs, ak.KeyID)
+		}
+	}
+
+	if cacheKey != "" {
+		if err := v.options.cache.store(signatureCacheEntry, cacheKey, outcome); err != nil {
+			v.options.logger.Warnf("Unable to cache signature check: %s", err)
+		}
+	}
+
+	return outcome.KeyIDs, outcome.Verified, nil
+}
+
+// predicateCheck collects the claims evaluated for one of a step's expected
+// predicates. err is set if the step cannot be met whatever the claims'
+// outcomes.
+type predicateCheck struct {
+	threshold int
+	claims    []*claimCheck
+	err       error
+}
+
+// claimCheck is the evaluation of a functionary's claim against a step's
+// expected predicate. failedChecks lists the rules the claim failed and
+// skippedRules the attribute rules not applied for lack of a field, while err
+// is set if the claim could not be evaluated.
+type claimCheck struct {
+	step              *Step
+	expectedPredicate ExpectedStepPredicates
+	functionary       string
+	statement         *attestationv1.Statement
+	lastStep          bool
+
+	failedChecks []error
+	skippedRules []SkippedRule
+	products     []*attestationv1.ResourceDescriptor
+	err          error
+}
+
+func (v *Verifier) checkClaim(ctx context.Context, claim *claimCheck, layout *Layout, claims map[string]map[AttestationIdentifier]*attestationv1.Statement, artifactHandlers *artifactHandlers, registry *PredicateRegistry) {
+	if claim.err = checkContext(ctx); claim.err != nil {
+		return
+	}
+
+	step, expectedPredicate, functionary, statement := claim.step, claim.expectedPredicate, claim.functionary, claim.statement
+	logger := v.options.logger.WithFields(log.Fields{"step": step.Name, "functionary": functionary})
+
+	logger.Infof("Verifying claim for step '%s' of type '%s' by '%s'...", step.Name, expectedPredicate.PredicateType, functionary)
+
+	ruleOptions := artifactRuleOptions{
+		patternMode:  layout.ArtifactPatternMode,
+		digestPolicy: layout.DigestPolicy,
+		matchQuorum:  step.MatchQuorum,
+		stepName:     step.Name,
+		handlers:     artifactHandlers,
+		logger:       logger,
+	}
+
+	if err := applyArtifactRules(statement, step.ExpectedMaterials, step.ExpectedProducts, ruleOptions, claims); err != nil {
+		claim.failedChecks = append(claim.failedChecks, fmt.Errorf("for step %s, claim by %s failed artifact rules: %w", step.Name, functionary, err))
+	}
+
+	if err := applySubjectRule(statement, expectedPredicate.SubjectMatchesProductsOf, ruleOptions, claims); err != nil {
+		claim.failedChecks = append(claim.failedChecks, fmt.Errorf("for step %s, claim by %s failed subject check: %w", step.Name, functionary, err))
+	}
+
+	if err := applyCommandRule(statement, step, logger); err != nil {
+		claim.failedChecks = append(claim.failedChecks, fmt.Errorf("for step %s, claim by %s failed command check: %w", step.Name, functionary, err))
+	}
+
+	handler := registry.Handler(statement.PredicateType)
+	programs, err := v.getPrograms(statement.PredicateType)
+	if err != nil {
+		claim.err = err
+		return
+	}
+
+	input, err := artifactHandlers.statements.activation(statement, handler, logger)
+	if err != nil {
+		claim.err = err
+		return
+	}
+
+	skippedRules, err := applyAttributeRules(ctx, programs, input, expectedPredicate.ExpectedAttributes, logger)
+	if err != nil {
+		claim.failedChecks = append(claim.failedChecks, fmt.Errorf("for step %s, claim by %s failed attribute rules: %w", step.Name, functionary, err))
+	}
+	for _, skipped := range skippedRules {
+		skipped.Step, skipped.Functionary = step.Name, functionary
+		claim.skippedRules = append(claim.skippedRules, skipped)
+	}
+
+	if len(claim.failedChecks) > 0 {
+		logger.Infof("Claim for step %s of type %s by %s failed.", step.Name, expectedPredicate.PredicateType, functionary)
+		return
+	}
+	logger.Info("Done.")
+
+	if claim.lastStep {
+		_, claim.products, claim.err = artifactHandlers.materialsAndProducts(step.Name, statement)
+	}
+}
+
+// getAttestations combines the attestations from the verifier's sources with
+// attestations, which take precedence.
+func (v *Verifier) getAttestations(ctx context.Context, attestations map[string]*dsse.Envelope) (map[string]*dsse.Envelope, error) {
+	combined := map[string]*dsse.Envelope{}
+	for _, source := range v.options.sources {
+		sourceAttestations, err := source.Attestations(ctx)
+		if err != nil {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
 			}
+
+			return nil, err
+		}
+
+		for name, envelope := range sourceAttestations {
+			combined[name] = envelope
 		}
 	}
 
-	log.Info("Verification successful!")
+	for name, envelope := range attestations {
+		combined[name] = envelope
+	}
 
-	return nil
+	if limit := v.options.limits.MaxAttestations; limit > 0 && len(combined)+len(v.options.links) > limit {
+		return nil, fmt.Errorf("%d attestations exceed the limit of %d", len(combined)+len(v.options.links), limit)
+	}
+
+	return combined, nil
+}
+
+// getPrograms returns the program cache for claims of the predicate type,
+// whose environment includes the variables of the predicate's handler.
+func (v *Verifier) getPrograms(predicateType string) (*programCache, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if programs, ok := v.programs[predicateType]; ok {
+		return programs, nil
+	}
+
+	env, err := getPredicateCELEnv(v.env, v.options.registry.Handler(predicateType))
+	if err != nil {
+		return nil, err
+	}
+
+	programs := &programCache{
+		env:          env,
+		costLimit:    v.options.limits.CELCostLimit,
+		explainRules: v.options.explain,
+		cached:       v.expressions,
+		programs:     map[string]cel.Program{},
+		tracked:      map[string]*trackedProgram{},
+	}
+	v.programs[predicateType] = programs
+
+	return programs, nil
+}
+
+// programCache compiles CEL expressions in an environment once.
+type programCache struct {
+	env       *cel.Env
+	costLimit uint64
+
+	// explainRules is set when failed rules are explained
+	explainRules bool
+
+	// cached holds the expressions whose programs are kept, those written in
+	// the layout. Expressions with parameters substituted are compiled on
+	// each use, so that callers choosing parameter values cannot grow the
+	// cache.
+	cached map[string]bool
+
+	mu       sync.Mutex
+	programs map[string]cel.Program
+	tracked  map[string]*trackedProgram
 }
 
-func getVerifiers(publicKeys map[string]Functionary) ([]dsse.Verifier, error) {
+func (c *programCache) program(expression string) (cel.Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if program, ok := c.programs[expression]; ok {
+		return program, nil
+	}
+
+	ast, issues := c.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	// Comprehensions check for a done context on every iteration. Nested
+	// comprehensions share the check counter, so checking less often lets
+	// outer loops run on long after the context is done.
+	programOptions := []cel.ProgramOption{cel.InterruptCheckFrequency(1)}
+	if c.costLimit > 0 {
+		programOptions = append(programOptions, cel.CostLimit(c.costLimit))
+	}
+
+	program, err := c.env.Program(ast, programOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if c.cached[expression] {
+		c.programs[expression] = program
+	}
+
+	return program, nil
+}
+
+func getVerifiers(publicKeys map[string]Functionary, logger log.FieldLogger) ([]dsse.Verifier, error) {
 	verifiers := []dsse.Verifier{}
 
-	for _, key := range publicKeys {
-		log.Infof("Creating verifier for key %s", key.KeyID)
+	keys := []Functionary{}
+	for _, functionary := range publicKeys {
+		keys = append(keys, getPublicKeys(functionary)...)
+	}
+
+	for _, key := range keys {
+		logger.Infof("Creating verifier for key %s", key.KeyID)
 		sslibKey := &signerverifier.SSLibKey{
 			KeyIDHashAlgorithms: key.KeyIDHashAlgorithms,
 			KeyType:             key.KeyType,
@@ -194,19 +876,55 @@ func getVerifiers(publicKeys map[string]Functionary) ([]dsse.Verifier, error) {
 	return verifiers, nil
 }
 
+// newEnvelopeVerifier returns a DSSE envelope verifier over a copy of
+// verifiers. dsse.EnvelopeVerifier reorders its verifiers in place while
+// verifying, so it must not be shared across envelopes when there is more than
+// one key.
+func newEnvelopeVerifier(threshold int, verifiers []dsse.Verifier) (*dsse.EnvelopeVerifier, error) {
+	return dsse.NewMultiEnvelopeVerifier(threshold, append([]dsse.Verifier{}, verifiers...)...)
+}
+
 func getPredicates(statements map[AttestationIdentifier]*attestationv1.Statement, predicateType string, functionaries []string) map[string]*attestationv1.Statement {
 	matchedPredicates := map[string]*attestationv1.Statement{}
 
-	for _, keyID := range functionaries {
-		statement, ok := statements[AttestationIdentifier{PredicateType: predicateType, Functionary: keyID}]
+	for _, functionary := range functionaries {
+		statement, ok := statements[AttestationIdentifier{PredicateType: predicateType, Functionary: functionary}]
 		if ok {
-			matchedPredicates[keyID] = statement
+			matchedPredicates[functionary] = statement
 		}
 	}
 
 	return matchedPredicates
 }
 
+// getAuthorizedClaims returns the claims of each of the layout's steps that are
+// of one of its expected predicate types and by a functionary listed for it.
+func getAuthorizedClaims(layout *Layout, keys map[string]functionaryKey, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) map[string]map[AttestationIdentifier]*attestationv1.Statement {
+	authorized := map[string]map[AttestationIdentifier]*attestationv1.Statement{}
+	for _, step := range layout.Steps {
+		for _, expectedPredicate := range getExpectedPredicates(step) {
+			for _, reference := range expectedPredicate.Functionaries {
+				identifier := AttestationIdentifier{
+					PredicateType: expectedPredicate.PredicateType,
+					Functionary:   resolveFunctionary(layout.Functionaries, keys, reference),
+				}
+
+				statement, ok := claims[step.Name][identifier]
+				if !ok {
+					continue
+				}
+
+				if authorized[step.Name] == nil {
+					authorized[step.Name] = map[AttestationIdentifier]*attestationv1.Statement{}
+				}
+				authorized[step.Name][identifier] = statement
+			}
+		}
+	}
+
+	return authorized
+}
+
 func getCELEnv() (*cel.Env, error) {
 	return cel.NewEnv(
 		cel.Types(&attestationv1.Statement{}),
@@ -216,76 +934,50 @@ func getCELEnv() (*cel.Env, error) {
 	)
 }
 
-func getActivation(statement *attestationv1.Statement) (interpreter.Activation, error) {
-	return interpreter.NewActivation(map[string]any{
-		"type":          statement.Type,
-		"subject":       statement.Subject,
-		"predicateType": statement.PredicateType,
-		"predicate":     statement.Predicate,
-	})
-}
-
-func getStepName(name string) string {
-	nameS := strings.Split(name, ".")
-	nameS = nameS[:len(nameS)-1]
-	return strings.Join(nameS, ".")
-}
+// getPredicateCELEnv extends env with the typed variables provided by the
+// predicate handler, if any.
+func getPredicateCELEnv(env *cel.Env, handler PredicateHandler) (*cel.Env, error) {
+	typed, ok := handler.(TypedPredicateHandler)
+	if !ok {
+		return env, nil
+	}
 
-func substituteParameters(layout *Layout, parameters map[string]string) (*Layout, error) {
-	replacementDirectives := make([]string, 0, 2*len(parameters))
-	re := regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+	options := typed.CELOptions()
+	if len(options) == 0 {
+		return env, nil
+	}
 
-	for parameter, value := range parameters {
-		if ok := re.MatchString(parameter); !ok {
-			return nil, fmt.Errorf("invalid parameter format")
-		}
+	return env.Extend(options...)
+}
 
-		parameterVar := fmt.Sprintf("{%s}", parameter)
-		if strings.Contains(value, parameterVar) {
-			return nil, fmt.Errorf("parameter's value refers to itself")
-		}
+// addClaims records statement as a claim by each key in keyIDs unless the
+// attestation or the key is revoked. It reports whether any claim was
+// recorded.
+func (v *Verifier) addClaims(stepClaims map[AttestationIdentifier]*attestationv1.Statement, attestationName string, payload []byte, statement *attestationv1.Statement, keyIDs []string) bool {
+	revocations := v.options.revocations
 
-		replacementDirectives = append(replacementDirectives, parameterVar)
-		replacementDirectives = append(replacementDirectives, value)
+	if revoked, reason := revocations.attestationRevoked(payload); revoked {
+		v.options.logger.Infof("Attestation %s is revoked (%s), skipping", attestationName, reason)
+		return false
 	}
 
-	replacer := strings.NewReplacer(replacementDirectives...)
-
-	for _, step := range layout.Steps {
-		for i, materialRule := range step.ExpectedMaterials {
-			step.ExpectedMaterials[i] = replace(replacer, materialRule)
-		}
-
-		for i, productRule := range step.ExpectedProducts {
-			step.ExpectedProducts[i] = replace(replacer, productRule)
+	added := false
+	for _, keyID := range keyIDs {
+		if revoked, reason := revocations.keyRevoked(keyID); revoked {
+			v.options.logger.Infof("Signature on %s by %s is revoked (%s), skipping", attestationName, keyID, reason)
+			continue
 		}
 
-		for _, predicateType := range step.ExpectedPredicates {
-			for i, attributeRule := range predicateType.ExpectedAttributes {
-				predicateType.ExpectedAttributes[i] = Constraint{
-					Rule:           replace(replacer, attributeRule.Rule),
-					AllowIfNoClaim: attributeRule.AllowIfNoClaim,
-					Warn:           attributeRule.Warn,
-					Debug:          replace(replacer, attributeRule.Debug),
-				}
-			}
-		}
+		functionaryKey := v.functionaryKeys[keyID]
+		stepClaims[AttestationIdentifier{Functionary: functionaryKey.name, PredicateType: statement.PredicateType}] = statement
+		added = true
 	}
 
-	return layout, nil
+	return added
 }
 
-func replace(replacer *strings.Replacer, input string) string {
-	var output string
-	for {
-		// repeat to catch embedded paramsub directives
-		output = replacer.Replace(input)
-		if output == input {
-			break
-		}
-
-		input = output
-	}
-
-	return output
+func getStepName(name string) string {
+	nameS := strings.Split(name, ".")
+	nameS = nameS[:len(nameS)-1]
+	return strings.Join(nameS, ".")
 }
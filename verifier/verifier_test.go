@@ -0,0 +1,299 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// readTestLayout reads an example layout from the layouts directory with its
+// expiry moved into the future.
+func readTestLayout(t *testing.T, name string) *Layout {
+	t.Helper()
+
+	layoutBytes, err := os.ReadFile(filepath.Join("..", "layouts", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := ParseLayout([]byte(strings.Replace(string(layoutBytes), `expires: "2024-10-10T12:23:22Z"`, `expires: "2124-10-10T12:23:22Z"`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return layout
+}
+
+// readTestAttestations reads the DSSE envelopes in an example attestations
+// directory, named as the verifier expects.
+func readTestAttestations(t *testing.T, dir string) map[string]*dsse.Envelope {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join("..", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestations := map[string]*dsse.Envelope{}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		envelopeBytes, err := os.ReadFile(filepath.Join("..", dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		envelope := &dsse.Envelope{}
+		if err := json.Unmarshal(envelopeBytes, envelope); err != nil {
+			t.Fatal(err)
+		}
+		attestations[strings.TrimSuffix(entry.Name(), ".json")] = envelope
+	}
+
+	return attestations
+}
+
+// readTestParameters reads an example parameters file.
+func readTestParameters(t *testing.T, name string) map[string]string {
+	t.Helper()
+
+	parametersBytes, err := os.ReadFile(filepath.Join("..", "parameters", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parameters := map[string]string{}
+	if err := json.Unmarshal(parametersBytes, &parameters); err != nil {
+		t.Fatal(err)
+	}
+
+	return parameters
+}
+
+func TestProgramCacheSubstitutedRules(t *testing.T) {
+	v, err := New(readTestLayout(t, "layout-npm.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestations := readTestAttestations(t, "test-data-npm")
+
+	if _, err := v.Verify(attestations, readTestParameters(t, "npm-sigstore.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		parameters := readTestParameters(t, "npm-sigstore.json")
+		parameters["github_repository_id"] = id
+		if _, err := v.Verify(attestations, parameters); err == nil {
+			t.Fatalf("verification with repository ID %s passed", id)
+		}
+	}
+
+	for predicateType, programs := range v.programs {
+		for expression := range programs.programs {
+			if !v.expressions[expression] {
+				t.Errorf("program for %s cached for %q, which is not in the layout", predicateType, expression)
+			}
+		}
+		for expression := range programs.tracked {
+			if !v.expressions[expression] {
+				t.Errorf("tracked program for %s cached for %q, which is not in the layout", predicateType, expression)
+			}
+		}
+	}
+}
+
+// cancellingHandler is the built-in link handler, cancelling a verification
+// when a claim's artifacts are first extracted.
+type cancellingHandler struct {
+	PredicateHandler
+	cancel context.CancelFunc
+}
+
+func (h *cancellingHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	h.cancel()
+	return h.PredicateHandler.MaterialsAndProducts(statement)
+}
+
+func TestVerifyAbortedClaims(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewPredicateRegistry()
+	if err := registry.Register(linkPredicateType, &cancellingHandler{PredicateHandler: registry.Handler(linkPredicateType), cancel: cancel}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		v, err := New(readTestLayout(t, "layout.yml"), WithPredicateRegistry(registry), WithConcurrency(concurrency))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = v.VerifyContext(ctx, readTestAttestations(t, "test-data"), nil)
+		if !errors.Is(err, ErrAborted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("with concurrency %d, error %v, want ErrAborted from the claim checks", concurrency, err)
+		}
+	}
+}
+
+func TestVerifyAbortedRule(t *testing.T) {
+	layout := readTestLayout(t, "layout.yml")
+
+	// A rule that takes far longer than the deadline to evaluate
+	hundred := make([]string, 100)
+	for i := range hundred {
+		hundred[i] = strconv.Itoa(i)
+	}
+	list := "[" + strings.Join(hundred, ", ") + "]"
+	rule := fmt.Sprintf("%[1]s.all(a, %[1]s.all(b, %[1]s.all(c, %[1]s.all(d, a + b + c + d >= 0))))", list)
+	for _, step := range layout.Steps {
+		if step.Name == "test" {
+			step.ExpectedPredicates[0].ExpectedAttributes = append(step.ExpectedPredicates[0].ExpectedAttributes, Constraint{Rule: rule})
+		}
+	}
+
+	v, err := New(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = v.VerifyContext(ctx, readTestAttestations(t, "test-data"), nil)
+	if !errors.Is(err, ErrAborted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want ErrAborted from the rule's evaluation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("verification returned %s after the deadline", elapsed)
+	}
+}
+
+func TestVerifyErrorOrder(t *testing.T) {
+	layout := readTestLayout(t, "layout.yml")
+	for _, step := range layout.Steps {
+		for i := range step.ExpectedPredicates {
+			step.ExpectedPredicates[i].ExpectedAttributes = append(step.ExpectedPredicates[i].ExpectedAttributes, Constraint{Rule: fmt.Sprintf("'%s' == 'passing'", step.Name)})
+		}
+	}
+	attestations := readTestAttestations(t, "test-data")
+
+	var first string
+	for run := 0; run < 20; run++ {
+		v, err := New(layout, WithConcurrency(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = v.Verify(attestations, nil)
+		if err == nil {
+			t.Fatal("verification with failing rules passed")
+		}
+
+		if run == 0 {
+			first = err.Error()
+			// Every step fails, and the first one in the layout is reported
+			if !strings.Contains(first, "'clone' == 'passing'") {
+				t.Fatalf("error %q, want the failure of the first step", first)
+			}
+			continue
+		}
+		if err.Error() != first {
+			t.Fatalf("error %q in run %d, want %q as in the first run", err, run, first)
+		}
+	}
+}
+
+func TestVerifyLazy(t *testing.T) {
+	attestations := readTestAttestations(t, "test-data")
+	attestations["deploy.broken"] = &dsse.Envelope{PayloadType: statementPayloadType, Payload: "not base64"}
+	attestations["deploy.skipped"] = nil
+	attestations["release.fe1c6281"] = attestations["build.fe1c6281"]
+
+	tests := []struct {
+		name     string
+		subjects []string
+		used     bool
+	}{
+		{name: "no subjects"},
+		{name: "other subject", subjects: []string{"bin/bar"}},
+		{name: "matching subject", subjects: []string{"bin/foo"}, used: true},
+		{name: "matching subject pattern", subjects: []string{"./bin/*"}, used: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout := readTestLayout(t, "layout.yml")
+			if test.subjects != nil {
+				layout.Subjects = []*Subject{{Subject: test.subjects}}
+			}
+
+			v, err := New(layout, WithLazyVerification())
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := v.Verify(attestations, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unused := []string{"deploy.broken", "deploy.skipped"}
+			if !test.used {
+				unused = append(unused, "release.fe1c6281")
+			}
+			sort.Strings(result.Unused)
+			if !reflect.DeepEqual(result.Unused, unused) {
+				t.Errorf("unused %v, want %v", result.Unused, unused)
+			}
+			if _, ok := result.Attestations["release.fe1c6281"]; ok != test.used {
+				t.Errorf("attestation about the subject verified %t, want %t", ok, test.used)
+			}
+		})
+	}
+
+	// Without lazy verification, attestations that were not loaded fail
+	v, err := New(readTestLayout(t, "layout.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(attestations, nil); err == nil {
+		t.Error("verification with attestations that were not loaded passed")
+	}
+}
+
+func TestUsesAttestation(t *testing.T) {
+	layout := readTestLayout(t, "layout.yml")
+
+	for name, used := range map[string]bool{
+		"clone.fe1c6281":  true,
+		"build.fe1c6281":  true,
+		"deploy.fe1c6281": false,
+		"deploy":          false,
+	} {
+		if UsesAttestation(layout, name) != used {
+			t.Errorf("UsesAttestation(%s) = %t, want %t", name, !used, used)
+		}
+	}
+
+	// Attestations for any step can be about the layout's subjects
+	layout.Subjects = []*Subject{{Subject: []string{"bin/foo"}}}
+	if !UsesAttestation(layout, "deploy.fe1c6281") {
+		t.Error("attestation not used by a layout with subjects")
+	}
+}
@@ -0,0 +1,255 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	vsaPredicateType = "https://slsa.dev/verification_summary/v1"
+
+	// statementPayloadType is the DSSE payload type of in-toto statements.
+	statementPayloadType = "application/vnd.in-toto+json"
+)
+
+// VerificationSummary is the SLSA verification summary attestation (VSA)
+// predicate.
+type VerificationSummary struct {
+	Verifier           VSAVerifier             `json:"verifier" cel:"verifier"`
+	TimeVerified       time.Time               `json:"timeVerified" cel:"timeVerified"`
+	ResourceURI        string                  `json:"resourceUri" cel:"resourceUri"`
+	Policy             VSAResourceDescriptor   `json:"policy" cel:"policy"`
+	InputAttestations  []VSAResourceDescriptor `json:"inputAttestations,omitempty" cel:"inputAttestations"`
+	VerificationResult string                  `json:"verificationResult" cel:"verificationResult"`
+	VerifiedLevels     []string                `json:"verifiedLevels" cel:"verifiedLevels"`
+	DependencyLevels   map[string]int64        `json:"dependencyLevels,omitempty" cel:"dependencyLevels"`
+	SlsaVersion        string                  `json:"slsaVersion,omitempty" cel:"slsaVersion"`
+}
+
+type VSAVerifier struct {
+	ID      string            `json:"id" cel:"id"`
+	Version map[string]string `json:"version,omitempty" cel:"version"`
+}
+
+type VSAResourceDescriptor struct {
+	URI    string            `json:"uri,omitempty" cel:"uri"`
+	Digest map[string]string `json:"digest,omitempty" cel:"digest"`
+}
+
+// VSAOptions holds the details of a verification summary that are not part of
+// the verification result.
+type VSAOptions struct {
+	Verifier VSAVerifier
+
+	// ResourceURI identifies the verified artifact. If empty, the name of
+	// the first product is used.
+	ResourceURI string
+
+	// Policy identifies the layout the attestations were verified against.
+	Policy VSAResourceDescriptor
+
+	VerifiedLevels []string
+}
+
+// GenerateVSA returns a statement with a passing verification summary for the
+// products of a successful verification.
+func GenerateVSA(result *Result, options VSAOptions) (*attestationv1.Statement, error) {
+	if options.Verifier.ID == "" {
+		return nil, fmt.Errorf("verification summary requires a verifier ID")
+	}
+
+	if len(result.Products) == 0 {
+		return nil, fmt.Errorf("no products to issue a verification summary for")
+	}
+
+	summary := VerificationSummary{
+		Verifier:           options.Verifier,
+		TimeVerified:       result.VerifiedAt.UTC().Truncate(time.Second),
+		ResourceURI:        options.ResourceURI,
+		Policy:             options.Policy,
+		VerificationResult: "PASSED",
+		VerifiedLevels:     options.VerifiedLevels,
+		SlsaVersion:        "1.0",
+	}
+	if summary.ResourceURI == "" {
+		summary.ResourceURI = result.Products[0].Name
+	}
+	if summary.VerifiedLevels == nil {
+		summary.VerifiedLevels = []string{}
+	}
+
+	attestationNames := make([]string, 0, len(result.Attestations))
+	for name := range result.Attestations {
+		attestationNames = append(attestationNames, name)
+	}
+	sort.Strings(attestationNames)
+
+	for _, name := range attestationNames {
+		summary.InputAttestations = append(summary.InputAttestations, VSAResourceDescriptor{
+			URI:    name,
+			Digest: result.Attestations[name],
+		})
+	}
+
+	summaryBytes, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(summaryBytes, predicate); err != nil {
+		return nil, err
+	}
+
+	return &attestationv1.Statement{
+		Type:          attestationv1.StatementTypeUri,
+		Subject:       result.Products,
+		PredicateType: vsaPredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+// SignVSA wraps the statement in a DSSE envelope signed by signer.
+func SignVSA(statement *attestationv1.Statement, signer dsse.SignerVerifier) (*dsse.Envelope, error) {
+	statementBytes, err := protojson.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	envelopeSigner, err := dsse.NewEnvelopeSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelopeSigner.SignPayload(context.Background(), statementPayloadType, statementBytes)
+}
+
+// LoadSigner loads a private key in the securesystemslib JSON format.
+func LoadSigner(path string) (dsse.SignerVerifier, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := signerverifier.LoadKeyFromSSLibBytes(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.KeyType {
+	case "rsa":
+		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(key)
+	case "ecdsa":
+		return signerverifier.NewECDSASignerVerifierFromSSLibKey(key)
+	case "ed25519":
+		return signerverifier.NewED25519SignerVerifierFromSSLibKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", key.KeyType)
+	}
+}
+
+func (e *ExpectedVSA) validate() error {
+	if e == nil {
+		return nil
+	}
+
+	for _, subjectDigest := range e.SubjectDigests {
+		if algorithm, digest, ok := strings.Cut(subjectDigest, ":"); !ok || algorithm == "" || digest == "" {
+			return fmt.Errorf("invalid subject digest %s, expected <algorithm>:<digest>", subjectDigest)
+		}
+	}
+
+	return nil
+}
+
+var slsaLevelPattern = regexp.MustCompile(`^(SLSA_[A-Z]+_LEVEL_)([0-9])$`)
+
+// getExpectedPredicates returns the step's expected predicates, including the
+// verification summary predicate described by its expectedVSA.
+func getExpectedPredicates(step *Step) []ExpectedStepPredicates {
+	if step.ExpectedVSA == nil {
+		return step.ExpectedPredicates
+	}
+
+	expectedPredicates := append([]ExpectedStepPredicates{}, step.ExpectedPredicates...)
+	return append(expectedPredicates, step.ExpectedVSA.expectedPredicate())
+}
+
+// expectedPredicate expresses the expected verification summary as attribute
+// rules on the vsa variable. Values from the layout are quoted, so they cannot
+// alter the rules.
+func (e *ExpectedVSA) expectedPredicate() ExpectedStepPredicates {
+	rules := []Constraint{{
+		Rule:  `vsa.verificationResult == "PASSED"`,
+		Debug: "verification summary does not report a passing result",
+	}}
+
+	if e.VerifierID != "" {
+		rules = append(rules, Constraint{
+			Rule:  fmt.Sprintf("vsa.verifier.id == %s", strconv.Quote(e.VerifierID)),
+			Debug: fmt.Sprintf("verification summary not issued by verifier %s", e.VerifierID),
+		})
+	}
+
+	if e.PolicyURI != "" {
+		rules = append(rules, Constraint{
+			Rule:  fmt.Sprintf("vsa.policy.uri == %s", strconv.Quote(e.PolicyURI)),
+			Debug: fmt.Sprintf("verification summary not issued for policy %s", e.PolicyURI),
+		})
+	}
+
+	algorithms := make([]string, 0, len(e.PolicyDigest))
+	for algorithm := range e.PolicyDigest {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	for _, algorithm := range algorithms {
+		rules = append(rules, Constraint{
+			Rule:  fmt.Sprintf("vsa.policy.digest[%s] == %s", strconv.Quote(algorithm), strconv.Quote(e.PolicyDigest[algorithm])),
+			Debug: fmt.Sprintf("verification summary not issued for policy with %s digest %s", algorithm, e.PolicyDigest[algorithm]),
+		})
+	}
+
+	// SLSA levels are recorded as the highest verified level of each
+	// track, so a higher level of the same track satisfies a lower one.
+	for _, level := range e.VerifiedLevels {
+		rule := fmt.Sprintf("%s in vsa.verifiedLevels", strconv.Quote(level))
+		if match := slsaLevelPattern.FindStringSubmatch(level); match != nil {
+			rule = fmt.Sprintf("vsa.verifiedLevels.exists(l, l.matches(%s))", strconv.Quote(fmt.Sprintf("^%s[%s-9]$", match[1], match[2])))
+		}
+
+		rules = append(rules, Constraint{
+			Rule:  rule,
+			Debug: fmt.Sprintf("verification summary does not verify level %s", level),
+		})
+	}
+
+	for _, subjectDigest := range e.SubjectDigests {
+		algorithm, digest, _ := strings.Cut(subjectDigest, ":")
+		rules = append(rules, Constraint{
+			Rule:  fmt.Sprintf("subject.exists(s, %s in s.digest && s.digest[%s] == %s)", strconv.Quote(algorithm), strconv.Quote(algorithm), strconv.Quote(digest)),
+			Debug: fmt.Sprintf("verification summary does not cover subject %s", subjectDigest),
+		})
+	}
+
+	return ExpectedStepPredicates{
+		PredicateType:      vsaPredicateType,
+		ExpectedAttributes: rules,
+		Functionaries:      e.Functionaries,
+		Threshold:          e.Threshold,
+	}
+}
@@ -0,0 +1,123 @@
+package verifier
+
+import (
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGenerateVSA(t *testing.T) {
+	result := &Result{
+		VerifiedAt:   time.Date(2024, 6, 1, 12, 0, 0, 500, time.UTC),
+		Attestations: map[string]map[string]string{"build.fe1c6281": {"sha256": "bb"}, "clone.fe1c6281": {"sha256": "aa"}},
+		Products:     []*attestationv1.ResourceDescriptor{{Name: "foo.tar.gz", Digest: map[string]string{"sha256": "cc"}}},
+	}
+	options := VSAOptions{
+		Verifier:       VSAVerifier{ID: "https://example.com/verifier"},
+		Policy:         VSAResourceDescriptor{URI: "https://example.com/layout.yml", Digest: map[string]string{"sha256": "dd"}},
+		VerifiedLevels: []string{"SLSA_BUILD_LEVEL_3"},
+	}
+
+	statement, err := GenerateVSA(result, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if statement.PredicateType != vsaPredicateType {
+		t.Errorf("predicate type %s, want %s", statement.PredicateType, vsaPredicateType)
+	}
+	if len(statement.Subject) != 1 || !proto.Equal(statement.Subject[0], result.Products[0]) {
+		t.Errorf("subject %v, want the products %v", statement.Subject, result.Products)
+	}
+
+	summary := &VerificationSummary{}
+	if err := decodePredicate(statement, summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.ResourceURI != "foo.tar.gz" {
+		t.Errorf("resource URI %s, want the first product", summary.ResourceURI)
+	}
+	if summary.Policy.URI != options.Policy.URI || summary.Policy.Digest["sha256"] != "dd" {
+		t.Errorf("policy %+v, want %+v", summary.Policy, options.Policy)
+	}
+	if len(summary.VerifiedLevels) != 1 || summary.VerifiedLevels[0] != "SLSA_BUILD_LEVEL_3" {
+		t.Errorf("verified levels %v, want %v", summary.VerifiedLevels, options.VerifiedLevels)
+	}
+	if summary.VerificationResult != "PASSED" || !summary.TimeVerified.Equal(result.VerifiedAt.Truncate(time.Second)) {
+		t.Errorf("result %s at %s, want PASSED at %s", summary.VerificationResult, summary.TimeVerified, result.VerifiedAt)
+	}
+	if len(summary.InputAttestations) != 2 || summary.InputAttestations[0].URI != "build.fe1c6281" || summary.InputAttestations[1].Digest["sha256"] != "aa" {
+		t.Errorf("input attestations %+v, want the attestations sorted by name", summary.InputAttestations)
+	}
+
+	if _, err := GenerateVSA(&Result{}, options); err == nil {
+		t.Error("summary generated without products")
+	}
+	if _, err := GenerateVSA(result, VSAOptions{}); err == nil {
+		t.Error("summary generated without a verifier ID")
+	}
+}
+
+func TestSignVSA(t *testing.T) {
+	signer, err := LoadSigner(filepath.Join("..", "test-data-raw", "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement, err := GenerateVSA(&Result{
+		VerifiedAt: time.Now(),
+		Products:   []*attestationv1.ResourceDescriptor{{Name: "foo.tar.gz", Digest: map[string]string{"sha256": "cc"}}},
+	}, VSAOptions{Verifier: VSAVerifier{ID: "https://example.com/verifier"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := SignVSA(statement, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.PayloadType != statementPayloadType {
+		t.Errorf("payload type %s, want %s", envelope.PayloadType, statementPayloadType)
+	}
+
+	envelopeVerifier, err := dsse.NewEnvelopeVerifier(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := envelopeVerifier.Verify(context.Background(), envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := signer.KeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != 1 || accepted[0].KeyID != keyID {
+		t.Errorf("accepted keys %+v, want %s", accepted, keyID)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := &attestationv1.Statement{}
+	if err := protojson.Unmarshal(payload, signed); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(signed, statement) {
+		t.Errorf("signed statement %v, want %v", signed, statement)
+	}
+
+	// A modified payload no longer verifies
+	envelope.Payload = base64.StdEncoding.EncodeToString(append(payload, ' '))
+	if _, err := envelopeVerifier.Verify(context.Background(), envelope); err == nil {
+		t.Error("modified summary verified")
+	}
+}
@@ -0,0 +1,579 @@
+package verifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+)
+
+const vulnsPredicateType = "https://in-toto.io/attestation/vulns/v0.1"
+
+// severityLevels orders the named severities findings are counted by.
+var severityLevels = []string{"NONE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// VulnerabilityScan is the in-toto vulnerability scan predicate.
+type VulnerabilityScan struct {
+	Scanner  VulnerabilityScanner      `json:"scanner" cel:"scanner"`
+	Metadata VulnerabilityScanMetadata `json:"metadata" cel:"metadata"`
+
+	// suppressed holds the reasons findings are suppressed, by ID.
+	suppressed map[string]string
+
+	// verifiedAt is the time of the verification the scan is evaluated in.
+	verifiedAt time.Time
+}
+
+type VulnerabilityScanner struct {
+	URI     string                `json:"uri" cel:"uri"`
+	Version string                `json:"version,omitempty" cel:"version"`
+	DB      VulnerabilityDB       `json:"db" cel:"db"`
+	Result  []VulnerabilityResult `json:"result" cel:"result"`
+}
+
+type VulnerabilityDB struct {
+	URI        string    `json:"uri,omitempty" cel:"uri"`
+	Version    string    `json:"version,omitempty" cel:"version"`
+	LastUpdate time.Time `json:"lastUpdate" cel:"lastUpdate"`
+}
+
+// VulnerabilityResult is a finding.
+type VulnerabilityResult struct {
+	ID          string                  `json:"id" cel:"id"`
+	Severity    []VulnerabilitySeverity `json:"severity" cel:"severity"`
+	Annotations []*structpb.Struct      `json:"annotations,omitempty" cel:"annotations"`
+}
+
+// UnmarshalJSON accepts the ID and severity both directly in the finding, as
+// in the specification's example, and nested in a vulnerability object, as
+// in its field list.
+func (r *VulnerabilityResult) UnmarshalJSON(data []byte) error {
+	type result VulnerabilityResult
+	finding := struct {
+		result
+		Vulnerability *struct {
+			ID       string                  `json:"id"`
+			Severity []VulnerabilitySeverity `json:"severity"`
+		} `json:"vulnerability"`
+	}{}
+	if err := json.Unmarshal(data, &finding); err != nil {
+		return err
+	}
+
+	*r = VulnerabilityResult(finding.result)
+	if finding.Vulnerability != nil {
+		if r.ID == "" {
+			r.ID = finding.Vulnerability.ID
+		}
+		if len(r.Severity) == 0 {
+			r.Severity = finding.Vulnerability.Severity
+		}
+	}
+
+	return nil
+}
+
+type VulnerabilitySeverity struct {
+	Method string `json:"method" cel:"method"`
+	Score  string `json:"score" cel:"score"`
+}
+
+type VulnerabilityScanMetadata struct {
+	ScanStartedOn  time.Time `json:"scanStartedOn" cel:"scanStartedOn"`
+	ScanFinishedOn time.Time `json:"scanFinishedOn" cel:"scanFinishedOn"`
+}
+
+// severity returns the highest named severity of the finding. Numeric scores
+// are read as CVSS scores, and CVSS v3 vectors are scored by their base
+// metrics.
+func (r VulnerabilityResult) severity() string {
+	highest := -1
+	for _, severity := range r.Severity {
+		level := severityLevel(severity.Score)
+		if score, err := strconv.ParseFloat(severity.Score, 64); err == nil {
+			level = cvssSeverityLevel(score)
+		} else if score, ok := cvss3BaseScore(severity.Score); ok {
+			level = cvssSeverityLevel(score)
+		}
+
+		if level > highest {
+			highest = level
+		}
+	}
+
+	if highest < 0 {
+		return "UNKNOWN"
+	}
+
+	return severityLevels[highest]
+}
+
+// cvssSeverityLevel returns the index in severityLevels of the CVSS
+// qualitative rating of score.
+func cvssSeverityLevel(score float64) int {
+	switch {
+	case score >= 9:
+		return 4
+	case score >= 7:
+		return 3
+	case score >= 4:
+		return 2
+	case score > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// cvss3Weights are the CVSS v3 base metric weights. The weights of
+// privileges required depend on the scope and are looked up by value and
+// scope.
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27, "LC": 0.68, "HC": 0.5, "NC": 0.85},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3BaseScore returns the base score of a CVSS v3.0 or v3.1 vector, such
+// as CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H. It reports false if the
+// vector is not a CVSS v3 vector with all base metrics.
+func cvss3BaseScore(vector string) (float64, bool) {
+	metrics, ok := strings.CutPrefix(vector, "CVSS:3.1/")
+	if !ok {
+		if metrics, ok = strings.CutPrefix(vector, "CVSS:3.0/"); !ok {
+			return 0, false
+		}
+	}
+
+	values := map[string]string{}
+	for _, metric := range strings.Split(metrics, "/") {
+		name, value, ok := strings.Cut(metric, ":")
+		if !ok {
+			return 0, false
+		}
+		if _, ok := values[name]; ok {
+			return 0, false
+		}
+		values[name] = value
+	}
+
+	scope := values["S"]
+	if scope != "U" && scope != "C" {
+		return 0, false
+	}
+
+	weights := map[string]float64{}
+	for name, metricWeights := range cvss3Weights {
+		value := values[name]
+		if name == "PR" && scope == "C" {
+			value += "C"
+		}
+
+		weight, ok := metricWeights[value]
+		if !ok {
+			return 0, false
+		}
+		weights[name] = weight
+	}
+
+	iss := 1 - (1-weights["C"])*(1-weights["I"])*(1-weights["A"])
+	impact := 6.42 * iss
+	if scope == "C" {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+
+	exploitability := 8.22 * weights["AV"] * weights["AC"] * weights["PR"] * weights["UI"]
+	score := impact + exploitability
+	if scope == "C" {
+		score *= 1.08
+	}
+
+	return cvss3RoundUp(math.Min(score, 10)), true
+}
+
+// cvss3RoundUp rounds up to one decimal as specified by CVSS v3.1, avoiding
+// floating point errors.
+func cvss3RoundUp(value float64) float64 {
+	scaled := int64(math.Round(value * 100000))
+	if scaled%10000 == 0 {
+		return float64(scaled) / 100000
+	}
+
+	return float64(scaled/10000+1) / 10
+}
+
+func severityLevel(severity string) int {
+	for i, level := range severityLevels {
+		if strings.EqualFold(level, severity) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// findings returns the IDs of the findings that are not suppressed and whose
+// severity is accepted by match.
+func (s VulnerabilityScan) findings(match func(string) bool) []string {
+	ids := []string{}
+	for _, result := range s.Scanner.Result {
+		if _, ok := s.suppressed[result.ID]; ok {
+			continue
+		}
+
+		if match(result.severity()) {
+			ids = append(ids, result.ID)
+		}
+	}
+
+	return ids
+}
+
+// VulnerabilityExceptions lists findings accepted in spite of vulnerability
+// gates.
+type VulnerabilityExceptions struct {
+	Exceptions []VulnerabilityException `yaml:"exceptions,omitempty"`
+}
+
+type VulnerabilityException struct {
+	ID      string `yaml:"id,omitempty"`
+	Reason  string `yaml:"reason,omitempty"`
+	Expires string `yaml:"expires,omitempty"`
+}
+
+// LoadVulnerabilityExceptions loads exceptions from a YAML or JSON file.
+func LoadVulnerabilityExceptions(path string) (*VulnerabilityExceptions, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := &VulnerabilityExceptions{}
+	if err := yaml.Unmarshal(contents, exceptions); err != nil {
+		return nil, err
+	}
+
+	for _, exception := range exceptions.Exceptions {
+		if exception.ID == "" {
+			return nil, fmt.Errorf("vulnerability exception without ID")
+		}
+
+		if exception.Expires != "" {
+			if _, err := time.Parse(time.RFC3339, exception.Expires); err != nil {
+				return nil, fmt.Errorf("invalid expiry for exception %s: %w", exception.ID, err)
+			}
+		}
+	}
+
+	return exceptions, nil
+}
+
+// VEXDocument is an OpenVEX document.
+type VEXDocument struct {
+	ID         string         `json:"@id"`
+	Statements []VEXStatement `json:"statements"`
+}
+
+type VEXStatement struct {
+	Vulnerability VEXVulnerability `json:"vulnerability"`
+	Products      []VEXProduct     `json:"products"`
+	Status        string           `json:"status"`
+	Justification string           `json:"justification,omitempty"`
+}
+
+// VEXVulnerability is given as an object by OpenVEX 0.2 and as a plain name
+// by earlier versions.
+type VEXVulnerability struct {
+	Name    string   `json:"name"`
+	ID      string   `json:"@id,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+func (v *VEXVulnerability) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &v.Name); err == nil {
+		return nil
+	}
+
+	type vulnerability VEXVulnerability
+	return json.Unmarshal(data, (*vulnerability)(v))
+}
+
+// VEXProduct is given as an object by OpenVEX 0.2 and as a plain identifier
+// by earlier versions.
+type VEXProduct struct {
+	ID          string            `json:"@id"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	Hashes      map[string]string `json:"hashes,omitempty"`
+}
+
+func (p *VEXProduct) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.ID); err == nil {
+		return nil
+	}
+
+	type product VEXProduct
+	return json.Unmarshal(data, (*product)(p))
+}
+
+// LoadVEXDocument loads an OpenVEX document.
+func LoadVEXDocument(path string) (*VEXDocument, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &VEXDocument{}
+	if err := json.Unmarshal(contents, document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+func (v VEXVulnerability) matches(id string) bool {
+	for _, name := range append([]string{v.Name, v.ID}, v.Aliases...) {
+		if name != "" && strings.EqualFold(name, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches reports whether the product identifies one of the subject's
+// artifacts, by an identifier equal to the artifact's normalized name or by
+// an equal digest.
+func (p VEXProduct) matches(subject []*attestationv1.ResourceDescriptor) bool {
+	ids := []string{p.ID}
+	for _, identifier := range p.Identifiers {
+		ids = append(ids, identifier)
+	}
+
+	for _, artifact := range subject {
+		for _, id := range ids {
+			if id != "" && artifact.Name != "" && normalizeArtifactName(id) == normalizeArtifactName(artifact.Name) {
+				return true
+			}
+		}
+
+		for algorithm, digest := range p.Hashes {
+			if digest == "" {
+				continue
+			}
+
+			if artifactDigest := artifact.Digest[strings.ReplaceAll(strings.ToLower(algorithm), "-", "")]; artifactDigest != "" && strings.EqualFold(artifactDigest, digest) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// vulnSuppressions holds the exceptions and VEX statements findings are
+// suppressed by.
+type vulnSuppressions struct {
+	exceptions *VulnerabilityExceptions
+	vex        []*VEXDocument
+	now        time.Time
+}
+
+// reason returns why the finding id in a scan of subject is suppressed.
+func (s *vulnSuppressions) reason(id string, subject []*attestationv1.ResourceDescriptor) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+
+	if s.exceptions != nil {
+		for _, exception := range s.exceptions.Exceptions {
+			if !strings.EqualFold(exception.ID, id) {
+				continue
+			}
+
+			if exception.Expires != "" {
+				expires, _ := time.Parse(time.RFC3339, exception.Expires)
+				if !s.now.Before(expires) {
+					continue
+				}
+			}
+
+			return fmt.Sprintf("exception: %s", exception.Reason), true
+		}
+	}
+
+	// Later statements supersede earlier ones
+	status := ""
+	for _, document := range s.vex {
+		for _, statement := range document.Statements {
+			if !statement.Vulnerability.matches(id) {
+				continue
+			}
+
+			// Statements without products would apply to every
+			// scanned artifact, so they are ignored
+			applies := false
+			for _, product := range statement.Products {
+				if product.matches(subject) {
+					applies = true
+					break
+				}
+			}
+
+			if applies {
+				status = statement.Status
+			}
+		}
+	}
+
+	if status == "not_affected" || status == "fixed" {
+		return fmt.Sprintf("VEX status %s", status), true
+	}
+
+	return "", false
+}
+
+// vulnsHandler provides the vulnerability scan predicate as the vulns
+// variable, with findings suppressed by exceptions and VEX statements. now is
+// the time of verification database ages are measured at.
+type vulnsHandler struct {
+	suppressions *vulnSuppressions
+	now          time.Time
+}
+
+func (h *vulnsHandler) MaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
+	return statement.Subject, nil, nil
+}
+
+func (h *vulnsHandler) CELOptions() []cel.EnvOption {
+	return (&builtinHandler{
+		variable:  "vulns",
+		typed:     func() any { return &VulnerabilityScan{} },
+		functions: vulnsFunctions,
+	}).CELOptions()
+}
+
+func (h *vulnsHandler) CELInput(statement *attestationv1.Statement) (map[string]any, error) {
+	scan := &VulnerabilityScan{}
+	if err := decodePredicate(statement, scan); err != nil {
+		return nil, err
+	}
+
+	scan.verifiedAt = h.now
+	scan.suppressed = map[string]string{}
+	for _, result := range scan.Scanner.Result {
+		if reason, ok := h.suppressions.reason(result.ID, statement.Subject); ok {
+			scan.suppressed[result.ID] = reason
+		}
+	}
+
+	return map[string]any{"vulns": *scan}, nil
+}
+
+func vulnsFunctions() []cel.EnvOption {
+	scanType := cel.ObjectType("verifier.VulnerabilityScan")
+	scan := func(value ref.Val) VulnerabilityScan {
+		return value.Value().(VulnerabilityScan)
+	}
+	severityArg := func(value ref.Val) (string, error) {
+		severity := strings.ToUpper(value.Value().(string))
+		if severity != "UNKNOWN" && severityLevel(severity) < 0 {
+			return "", fmt.Errorf("unknown severity %s", severity)
+		}
+
+		return severity, nil
+	}
+
+	return []cel.EnvOption{
+		cel.Function("count",
+			cel.MemberOverload("vulnerabilityscan_count", []*cel.Type{scanType, cel.StringType}, cel.IntType,
+				cel.BinaryBinding(func(value, severityValue ref.Val) ref.Val {
+					severity, err := severityArg(severityValue)
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					return types.Int(len(scan(value).findings(func(s string) bool { return s == severity })))
+				}),
+			),
+		),
+		cel.Function("countAtLeast",
+			cel.MemberOverload("vulnerabilityscan_count_at_least", []*cel.Type{scanType, cel.StringType}, cel.IntType,
+				cel.BinaryBinding(func(value, severityValue ref.Val) ref.Val {
+					severity, err := severityArg(severityValue)
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					// Findings of unknown severity might be of any
+					// severity, so they are counted at every threshold
+					minimum := severityLevel(severity)
+					return types.Int(len(scan(value).findings(func(s string) bool {
+						return s == "UNKNOWN" || (minimum >= 0 && severityLevel(s) >= minimum)
+					})))
+				}),
+			),
+		),
+		cel.Function("findings",
+			cel.MemberOverload("vulnerabilityscan_findings", []*cel.Type{scanType, cel.StringType}, cel.ListType(cel.StringType),
+				cel.BinaryBinding(func(value, severityValue ref.Val) ref.Val {
+					severity, err := severityArg(severityValue)
+					if err != nil {
+						return types.WrapErr(err)
+					}
+
+					return types.DefaultTypeAdapter.NativeToValue(scan(value).findings(func(s string) bool { return s == severity }))
+				}),
+			),
+		),
+		cel.Function("suppressed",
+			cel.MemberOverload("vulnerabilityscan_suppressed", []*cel.Type{scanType}, cel.ListType(cel.StringType),
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					ids := []string{}
+					for id := range scan(value).suppressed {
+						ids = append(ids, id)
+					}
+					sort.Strings(ids)
+
+					return types.DefaultTypeAdapter.NativeToValue(ids)
+				}),
+			),
+		),
+		cel.Function("dbAge",
+			cel.MemberOverload("vulnerabilityscan_db_age", []*cel.Type{scanType}, cel.DurationType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					s := scan(value)
+					if s.Scanner.DB.LastUpdate.IsZero() {
+						return types.NewErr("scan does not record when its database was updated")
+					}
+
+					// Scan times are asserted by the scanner, so ages are
+					// measured at the time of verification
+					verifiedAt := s.verifiedAt
+					if verifiedAt.IsZero() {
+						verifiedAt = time.Now()
+					}
+
+					return types.Duration{Duration: verifiedAt.Sub(s.Scanner.DB.LastUpdate)}
+				}),
+			),
+		),
+	}
+}
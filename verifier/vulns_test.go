@@ -0,0 +1,259 @@
+package verifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestVEXSuppression(t *testing.T) {
+	subject := []*attestationv1.ResourceDescriptor{
+		{Name: "app", Digest: map[string]string{"sha256": "aa"}},
+	}
+
+	tests := []struct {
+		name       string
+		statements []VEXStatement
+		suppressed bool
+	}{
+		{
+			name: "product by digest",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "other", Hashes: map[string]string{"SHA-256": "aa"}}},
+				Status:        "not_affected",
+			}},
+			suppressed: true,
+		},
+		{
+			name: "product by other digest",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "other", Hashes: map[string]string{"sha256": "bb"}}},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "product by empty digest",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "other", Hashes: map[string]string{"sha512": ""}}},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "identifier containing the digest",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "pkg:oci/other@sha256:aa"}},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "product by name",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "app"}},
+				Status:        "fixed",
+			}},
+			suppressed: true,
+		},
+		{
+			name: "no products",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "other product",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+				Products:      []VEXProduct{{ID: "pkg:oci/other@sha256:bb"}},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "other vulnerability",
+			statements: []VEXStatement{{
+				Vulnerability: VEXVulnerability{Name: "CVE-2023-9999"},
+				Products:      []VEXProduct{{ID: "app"}},
+				Status:        "not_affected",
+			}},
+		},
+		{
+			name: "superseded",
+			statements: []VEXStatement{
+				{
+					Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+					Products:      []VEXProduct{{ID: "app"}},
+					Status:        "not_affected",
+				},
+				{
+					Vulnerability: VEXVulnerability{Name: "CVE-2023-1234"},
+					Products:      []VEXProduct{{ID: "app"}},
+					Status:        "affected",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suppressions := &vulnSuppressions{vex: []*VEXDocument{{Statements: test.statements}}}
+			if _, suppressed := suppressions.reason("CVE-2023-1234", subject); suppressed != test.suppressed {
+				t.Errorf("suppressed %t, want %t", suppressed, test.suppressed)
+			}
+		})
+	}
+}
+
+func TestDBAge(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// the scan claims to have run right after its database was updated
+	predicate, err := structpb.NewStruct(map[string]any{
+		"scanner": map[string]any{
+			"uri": "https://example.com/scanner",
+			"db":  map[string]any{"lastUpdate": "2024-01-01T00:00:00Z"},
+		},
+		"metadata": map[string]any{
+			"scanStartedOn":  "2024-01-01T00:00:00Z",
+			"scanFinishedOn": "2024-01-01T01:00:00Z",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &vulnsHandler{now: now}
+	env, err := cel.NewEnv(handler.CELOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ast, issues := env.Compile("vulns.dbAge()")
+	if issues != nil && issues.Err() != nil {
+		t.Fatal(issues.Err())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := handler.CELInput(&attestationv1.Statement{PredicateType: vulnsPredicateType, Predicate: predicate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, _, err := program.Eval(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if age := value.Value().(time.Duration); age != now.Sub(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("database age %s, want the age at the time of verification", age)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		scores   []string
+		severity string
+	}{
+		{scores: []string{"9.8"}, severity: "CRITICAL"},
+		{scores: []string{"0"}, severity: "NONE"},
+		{scores: []string{"high"}, severity: "HIGH"},
+		{scores: []string{"LOW", "5.0"}, severity: "MEDIUM"},
+		{scores: []string{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}, severity: "CRITICAL"},
+		{scores: []string{"CVSS:3.0/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N"}, severity: "MEDIUM"},
+		{scores: []string{"CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N"}, severity: "LOW"},
+		{scores: []string{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N"}, severity: "NONE"},
+		{scores: []string{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H"}, severity: "UNKNOWN"},
+		{scores: []string{"CVSS:2.0/AV:N/AC:L/Au:N/C:P/I:P/A:P"}, severity: "UNKNOWN"},
+		{scores: []string{"important"}, severity: "UNKNOWN"},
+		{severity: "UNKNOWN"},
+	}
+
+	for _, test := range tests {
+		result := VulnerabilityResult{ID: "CVE-2023-1234"}
+		for _, score := range test.scores {
+			result.Severity = append(result.Severity, VulnerabilitySeverity{Method: "CVSSv3", Score: score})
+		}
+
+		if severity := result.severity(); severity != test.severity {
+			t.Errorf("severity of %v is %s, want %s", test.scores, severity, test.severity)
+		}
+	}
+}
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10,
+		"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:L/I:L/A:N": 6.4,
+		"CVSS:3.0/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N": 6.1,
+		"CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N": 5.5,
+		"CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N": 1.8,
+	}
+
+	for vector, want := range tests {
+		score, ok := cvss3BaseScore(vector)
+		if !ok || score != want {
+			t.Errorf("base score of %s is %v (%t), want %v", vector, score, ok, want)
+		}
+	}
+}
+
+func TestCountAtLeastUnknown(t *testing.T) {
+	predicate, err := structpb.NewStruct(map[string]any{
+		"scanner": map[string]any{
+			"uri": "https://example.com/scanner",
+			"result": []any{
+				map[string]any{"id": "CVE-2023-0001", "severity": []any{map[string]any{"method": "CVSSv3", "score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}}},
+				map[string]any{"id": "CVE-2023-0002", "severity": []any{map[string]any{"method": "vendor", "score": "important"}}},
+				map[string]any{"id": "CVE-2023-0003", "severity": []any{map[string]any{"method": "CVSSv3", "score": "2.0"}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &vulnsHandler{}
+	env, err := cel.NewEnv(handler.CELOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := handler.CELInput(&attestationv1.Statement{PredicateType: vulnsPredicateType, Predicate: predicate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int64{
+		"vulns.countAtLeast('CRITICAL')": 2,
+		"vulns.countAtLeast('LOW')":      3,
+		"vulns.count('UNKNOWN')":         1,
+	}
+	for expression, want := range tests {
+		ast, issues := env.Compile(expression)
+		if issues != nil && issues.Err() != nil {
+			t.Fatal(issues.Err())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, _, err := program.Eval(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := value.Value().(int64); count != want {
+			t.Errorf("%s is %d, want %d", expression, count, want)
+		}
+	}
+}